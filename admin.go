@@ -0,0 +1,73 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// middlewareAdminAuth only lets requests carrying the admin key through
+func (cfg *apiConfig) middlewareAdminAuth(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		adminSecret := strings.TrimPrefix(r.Header.Get("Authorization"), "ApiKey ")
+		if cfg.adminSecret == "" || adminSecret != cfg.adminSecret {
+			respondWithError(w, 401, "Unauthorized!")
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+func (cfg *apiConfig) snapshotName() string {
+	return fmt.Sprintf("snapshot-%s%s", time.Now().Format("20060102T150405"), filepath.Ext(cfg.dbConfig.Path))
+}
+
+// handlerGetSnapshot streams a point-in-time snapshot of the database
+func (cfg *apiConfig) handlerGetSnapshot(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/octet-stream")
+	w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=%q", cfg.snapshotName()))
+	err := cfg.db.Backup(w)
+	if err != nil {
+		// Too late to change the status once the body has started.
+		log.Print(err.Error())
+	}
+}
+
+// handlerPostSnapshot saves a point-in-time snapshot of the database
+// into the backup directory on the server
+func (cfg *apiConfig) handlerPostSnapshot(w http.ResponseWriter, r *http.Request) {
+	err := os.MkdirAll(cfg.backupDir, 0755)
+	if err != nil {
+		log.Print(err.Error())
+		respondWithError(w, 500, "Something went wrong!")
+		return
+	}
+	path := filepath.Join(cfg.backupDir, cfg.snapshotName())
+	file, err := os.OpenFile(path, os.O_CREATE|os.O_EXCL|os.O_WRONLY, 0666)
+	if err != nil {
+		log.Print(err.Error())
+		respondWithError(w, 500, "Something went wrong!")
+		return
+	}
+	err = cfg.db.Backup(file)
+	if err == nil {
+		err = file.Sync()
+	}
+	file.Close()
+	if err != nil {
+		log.Print(err.Error())
+		os.Remove(path)
+		respondWithError(w, 500, "Something went wrong with the DB!")
+		return
+	}
+	response := struct {
+		File string `json:"file"`
+	}{
+		File: path,
+	}
+	respondWithJSON(w, 201, response)
+}
@@ -0,0 +1,36 @@
+package main
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+// authenticate returns the id of the user whose access token
+// is in the Authorization header of r
+func (cfg *apiConfig) authenticate(r *http.Request) (int, error) {
+	tokenString := strings.TrimPrefix(r.Header.Get("Authorization"), "Bearer ")
+	claims := jwt.RegisteredClaims{}
+	_, err := jwt.ParseWithClaims(tokenString, &claims, func(token *jwt.Token) (interface{}, error) {
+		return []byte(cfg.jwtSecret), nil
+	})
+	if err != nil {
+		return 0, err
+	}
+	if claims.Issuer != "Chirpy-Access" {
+		return 0, errors.New("Not an access token!")
+	}
+	return strconv.Atoi(claims.Subject)
+}
+
+// authenticateOptional is authenticate for endpoints that also serve
+// anonymous users, returning 0 when there is no Authorization header
+func (cfg *apiConfig) authenticateOptional(r *http.Request) (int, error) {
+	if r.Header.Get("Authorization") == "" {
+		return 0, nil
+	}
+	return cfg.authenticate(r)
+}
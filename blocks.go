@@ -0,0 +1,50 @@
+package main
+
+import (
+	"log"
+	"net/http"
+)
+
+// userRelationHandler answers POST and DELETE on the /users/{id}
+// routes relating the caller to another user, like block and mute
+func (cfg *apiConfig) userRelationHandler(relate func(userId int, otherId int) error) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		userId, err := cfg.authenticate(r)
+		if err != nil {
+			log.Print(err.Error())
+			respondWithError(w, 401, "Unauthorized!")
+			return
+		}
+		otherId, err := userIdParam(r)
+		if err != nil {
+			respondWithError(w, 400, "Invalid user id!")
+			return
+		}
+		err = relate(userId, otherId)
+		if err != nil {
+			respondWithDBError(w, err)
+			return
+		}
+		w.WriteHeader(204)
+	}
+}
+
+// handlerPostBlock stops a user from replying to, mentioning, liking
+// or following the caller, and makes them unfollow the caller
+func (cfg *apiConfig) handlerPostBlock(w http.ResponseWriter, r *http.Request) {
+	cfg.userRelationHandler(cfg.db.BlockUser)(w, r)
+}
+
+func (cfg *apiConfig) handlerDeleteBlock(w http.ResponseWriter, r *http.Request) {
+	cfg.userRelationHandler(cfg.db.UnblockUser)(w, r)
+}
+
+// handlerPostMute leaves the chirps of a user out of the chirp
+// listings and feeds of the caller
+func (cfg *apiConfig) handlerPostMute(w http.ResponseWriter, r *http.Request) {
+	cfg.userRelationHandler(cfg.db.MuteUser)(w, r)
+}
+
+func (cfg *apiConfig) handlerDeleteMute(w http.ResponseWriter, r *http.Request) {
+	cfg.userRelationHandler(cfg.db.UnmuteUser)(w, r)
+}
@@ -2,96 +2,97 @@ package main
 
 import (
 	"encoding/json"
+	"errors"
+	"io"
 	"log"
 	"net/http"
-	"sort"
 	"strconv"
-	"strings"
 
 	"github.com/aliasboink/go_web_server/internal/database"
 	"github.com/go-chi/chi/v5"
-	"github.com/golang-jwt/jwt/v5"
 )
 
 func (cfg *apiConfig) handlerDeleteChirp(w http.ResponseWriter, r *http.Request) {
-	// This could be a function
-	tokenString := strings.TrimPrefix(r.Header.Get("Authorization"), "Bearer ")
-	claims := jwt.RegisteredClaims{}
-	jwtToken, err := jwt.ParseWithClaims(tokenString, &claims, func(token *jwt.Token) (interface{}, error) {
-		return []byte(cfg.jwtSecret), nil
-	})
+	userId, err := cfg.authenticate(r)
 	if err != nil {
 		log.Print(err.Error())
 		respondWithError(w, 401, "Unauthorized!")
 		return
 	}
-	issuer, err := claims.GetIssuer()
-	if err != nil || issuer != "Chirpy-Access" {
-		respondWithError(w, 401, "Unauthorized!")
+	chirp, err := cfg.resolveVisibleChirp(chi.URLParam(r, "id"), userId)
+	if err != nil {
+		respondWithDBError(w, err)
 		return
 	}
-	// Up to here
-	chirpUrlId := chi.URLParam(r, "id")
-	userId, err := jwtToken.Claims.GetSubject()
+	// The ownership check is repeated inside the delete
+	// so nothing can happen to the chirp in between.
+	err = cfg.db.DeleteOwnChirp(chirp.Id, userId)
 	if err != nil {
-		log.Print(err.Error())
-		respondWithError(w, 500, "Something went wrong!")
+		respondWithDBError(w, err)
 		return
 	}
-	db, err := database.NewDB("database.json")
+	w.WriteHeader(200)
+	return
+}
+
+// cleanChirpBody checks the length of a chirp body and runs it through
+// the profanity filter, returning the body with its profanities masked
+// and the words it should be reviewed for
+func (cfg *apiConfig) cleanChirpBody(body string) (string, []string, error) {
+	if len(body) > 140 {
+		return "", nil, errors.New("Chirp is too long!")
+	}
+	verdict := cfg.filter.Load().Check(body)
+	if len(verdict.Rejected) > 0 {
+		return "", nil, errors.New("Chirp contains banned words!")
+	}
+	return verdict.Body, verdict.Flagged, nil
+}
+
+func (cfg *apiConfig) handlerPostChirp(w http.ResponseWriter, r *http.Request) {
+	userId, err := cfg.authenticate(r)
 	if err != nil {
-		log.Println(err.Error())
-		respondWithError(w, 500, "Something went wrong with the DB!")
+		log.Print(err.Error())
+		respondWithError(w, 401, "Unauthorized!")
 		return
 	}
-	// I don't necessarily really like handling
-	// the error like this, but it's a way I'm trying out.
-	err = db.ChirpBelongsToUser(chirpUrlId, userId)
+	type parameters struct {
+		Body       string `json:"body"`
+		InReplyTo  int    `json:"in_reply_to"`
+		Visibility string `json:"visibility"`
+	}
+	decoder := json.NewDecoder(r.Body)
+	params := parameters{}
+	err = decoder.Decode(&params)
 	if err != nil {
-		if err.Error() == "Forbidden!" {
-			log.Print(err.Error())
-			respondWithError(w, 403, err.Error())
-			return
-		} else if err.Error() == "Not found!" {
-			log.Print(err.Error())
-			respondWithError(w, 404, err.Error())
-			return
-		}
 		respondWithError(w, 500, "Something went wrong!")
 		return
 	}
-	err = db.DeleteChirp(chirpUrlId)
-	if err != nil {
-		log.Print(err.Error())
-		respondWithError(w, 500, "Something went wrong with the DB!")
+	if params.Visibility != "" && !database.ValidVisibility(params.Visibility) {
+		respondWithError(w, 400, "Invalid visibility!")
 		return
 	}
-	w.WriteHeader(200)
-	return
-}
-
-func (cfg *apiConfig) handlerPostChirp(w http.ResponseWriter, r *http.Request) {
-	// This could be a function
-	tokenString := strings.TrimPrefix(r.Header.Get("Authorization"), "Bearer ")
-	claims := jwt.RegisteredClaims{}
-	jwtToken, err := jwt.ParseWithClaims(tokenString, &claims, func(token *jwt.Token) (interface{}, error) {
-		return []byte(cfg.jwtSecret), nil
-	})
+	body, flagged, err := cfg.cleanChirpBody(params.Body)
 	if err != nil {
-		log.Print(err.Error())
-		respondWithError(w, 401, "Unauthorized!")
+		respondWithError(w, 400, err.Error())
 		return
 	}
-	issuer, err := claims.GetIssuer()
-	if err != nil || issuer != "Chirpy-Access" {
-		respondWithError(w, 401, "Unauthorized!")
+	chirp, err := cfg.db.PostChirp(database.Chirp{Body: body, AuthorId: userId, InReplyTo: params.InReplyTo, Visibility: params.Visibility})
+	if err != nil {
+		respondWithDBError(w, err)
 		return
 	}
-	// Up to here
-	userId, err := jwtToken.Claims.GetSubject()
+	cfg.flagChirp(chirp, flagged)
+	respondWithJSON(w, 201, chirp)
+}
+
+// handlerPutChirp edits the body of one of the user's own chirps,
+// serving both PUT and PATCH since the body is all there is to change
+func (cfg *apiConfig) handlerPutChirp(w http.ResponseWriter, r *http.Request) {
+	userId, err := cfg.authenticate(r)
 	if err != nil {
 		log.Print(err.Error())
-		respondWithError(w, 500, "Something went wrong!")
+		respondWithError(w, 401, "Unauthorized!")
 		return
 	}
 	type parameters struct {
@@ -104,93 +105,281 @@ func (cfg *apiConfig) handlerPostChirp(w http.ResponseWriter, r *http.Request) {
 		respondWithError(w, 500, "Something went wrong!")
 		return
 	}
-	if len(params.Body) > 140 {
-		respondWithError(w, 400, "Chirp is too long!")
+	body, flagged, err := cfg.cleanChirpBody(params.Body)
+	if err != nil {
+		respondWithError(w, 400, err.Error())
 		return
 	}
-	db, err := database.NewDB("database.json")
+	chirp, err := cfg.resolveVisibleChirp(chi.URLParam(r, "id"), userId)
 	if err != nil {
-		respondWithError(w, 500, "Something went wrong with the DB!")
+		respondWithDBError(w, err)
 		return
 	}
-	profaneWords := []string{"kerfuffle", "sharbert", "fornax"}
-	chirp, err := db.CreateChirp(cleanTheProfanities(params.Body, profaneWords), userId)
+	chirp, err = cfg.db.EditChirp(chirp.Id, userId, body)
 	if err != nil {
-		respondWithError(w, 500, "Something went wrong creating the chirp!")
+		respondWithDBError(w, err)
 		return
 	}
-	respondWithJSON(w, 201, chirp)
+	cfg.flagChirp(chirp, flagged)
+	respondWithJSON(w, 200, chirp)
+}
+
+// handlerGetChirpHistory lists every version of a chirp, oldest first
+func (cfg *apiConfig) handlerGetChirpHistory(w http.ResponseWriter, r *http.Request) {
+	userId, err := cfg.authenticateOptional(r)
+	if err != nil {
+		log.Print(err.Error())
+		respondWithError(w, 401, "Unauthorized!")
+		return
+	}
+	chirp, err := cfg.resolveVisibleChirp(chi.URLParam(r, "id"), userId)
+	if err != nil {
+		respondWithDBError(w, err)
+		return
+	}
+	history, err := cfg.db.GetChirpHistory(chirp.Id)
+	if err != nil {
+		respondWithDBError(w, err)
+		return
+	}
+	respondWithJSON(w, 200, history)
 }
 
-func handlerGetChirps(w http.ResponseWriter, r *http.Request) {
-	db, err := database.NewDB("database.json")
+// handlerGetChirpThread returns the conversation a chirp is part of,
+// its ancestors first, then the chirp and then its replies depth first
+func (cfg *apiConfig) handlerGetChirpThread(w http.ResponseWriter, r *http.Request) {
+	userId, err := cfg.authenticateOptional(r)
+	if err != nil {
+		log.Print(err.Error())
+		respondWithError(w, 401, "Unauthorized!")
+		return
+	}
+	chirp, err := cfg.resolveVisibleChirp(chi.URLParam(r, "id"), userId)
 	if err != nil {
-		respondWithError(w, 500, "Something went wrong with the DB!")
+		respondWithDBError(w, err)
 		return
 	}
-	chirps, err := db.GetChirps()
+	thread, err := cfg.db.GetThread(chirp.Id, userId)
 	if err != nil {
-		respondWithError(w, 500, "Something went wrong with chirps!")
+		respondWithDBError(w, err)
 		return
 	}
-	sortUrl := r.URL.Query().Get("sort")
-	if sortUrl == "asc" {
-		sort.Slice(chirps, func(i, j int) bool {
-			return chirps[i].Id < chirps[j].Id
-		})
+	response, err := cfg.renderChirps(thread, userId)
+	if err != nil {
+		respondWithDBError(w, err)
+		return
+	}
+	respondWithJSON(w, 200, response)
+}
+
+// handlerPostRechirp reshares a chirp, as a plain rechirp
+// or, given a body, as a quote with the user's commentary
+func (cfg *apiConfig) handlerPostRechirp(w http.ResponseWriter, r *http.Request) {
+	userId, err := cfg.authenticate(r)
+	if err != nil {
+		log.Print(err.Error())
+		respondWithError(w, 401, "Unauthorized!")
+		return
 	}
-	if sortUrl == "desc" {
-		sort.Slice(chirps, func(i, j int) bool {
-			return chirps[i].Id > chirps[j].Id
-		})
+	type parameters struct {
+		Body string `json:"body"`
 	}
-	// Removing an element by value from a slice shouldn't be too
-	//common in your program since it is an O(n) operation
-	//and there are better data structures in the language for that.
-	//Therefore, Go does not provide a built-in remove function for
-	//slices. Apparently. Very unfortunate.
-	var filteredChirps []database.Chirp
+	params := parameters{}
+	// The body is optional, so is the whole request body.
+	err = json.NewDecoder(r.Body).Decode(&params)
+	if err != nil && !errors.Is(err, io.EOF) {
+		respondWithError(w, 500, "Something went wrong!")
+		return
+	}
+	chirp, err := cfg.resolveVisibleChirp(chi.URLParam(r, "id"), userId)
+	if err != nil {
+		respondWithDBError(w, err)
+		return
+	}
+	rechirp := database.Chirp{AuthorId: userId, RefChirpId: chirp.Id, RefKind: database.RefRechirp}
+	var flagged []string
+	if params.Body != "" {
+		rechirp.Body, flagged, err = cfg.cleanChirpBody(params.Body)
+		if err != nil {
+			respondWithError(w, 400, err.Error())
+			return
+		}
+		rechirp.RefKind = database.RefQuote
+	}
+	rechirp, err = cfg.db.PostChirp(rechirp)
+	if err != nil {
+		respondWithDBError(w, err)
+		return
+	}
+	cfg.flagChirp(rechirp, flagged)
+	response, err := cfg.renderChirps([]database.Chirp{rechirp}, userId)
+	if err != nil {
+		respondWithDBError(w, err)
+		return
+	}
+	respondWithJSON(w, 201, response[0])
+}
+
+// handlerGetChirps lists chirps, optionally by author_id and created
+// between since and until, ordered by creation time as sort says and
+// paged with limit and cursor, leaving out the users the caller muted
+// and the chirps they may not see.
+// When there are more chirps the Link header points at the next page.
+func (cfg *apiConfig) handlerGetChirps(w http.ResponseWriter, r *http.Request) {
+	userId, err := cfg.authenticateOptional(r)
+	if err != nil {
+		log.Print(err.Error())
+		respondWithError(w, 401, "Unauthorized!")
+		return
+	}
+	query := database.ChirpQuery{}
 	authorId := r.URL.Query().Get("author_id")
 	if authorId != "" {
 		authorIdInt, err := strconv.Atoi(authorId)
 		if err != nil {
-			log.Print(err.Error())
-			respondWithError(w, 500, "Something went wrong!")
+			respondWithError(w, 400, "Invalid author id!")
 			return
 		}
-		for _, chirp := range chirps {
-			if chirp.AuthorId == authorIdInt {
-				filteredChirps = append(filteredChirps, chirp)
-			}
-		}
-		respondWithJSON(w, 200, filteredChirps)
+		query.AuthorId = authorIdInt
+	}
+	limit, err := parseChirpPage(r.URL.Query(), &query)
+	if err != nil {
+		respondWithError(w, 400, err.Error())
 		return
 	}
-	respondWithJSON(w, 200, chirps)
-	return
+	query.Desc = r.URL.Query().Get("sort") == "desc"
+	query.MutedBy = userId
+	query.ViewerId = userId
+	chirps, err := cfg.db.QueryChirps(query)
+	if err != nil {
+		respondWithDBError(w, err)
+		return
+	}
+	cfg.respondWithChirpPage(w, r, chirps, limit, userId)
 }
 
-func handlerGetChirpWithId(w http.ResponseWriter, r *http.Request) {
-	id := chi.URLParam(r, "id")
-	db, err := database.NewDB("database.json")
+// handlerGetTimeline lists the chirps of the user and of the users they
+// follow, newest first and paged like handlerGetChirps
+func (cfg *apiConfig) handlerGetTimeline(w http.ResponseWriter, r *http.Request) {
+	userId, err := cfg.authenticate(r)
+	if err != nil {
+		log.Print(err.Error())
+		respondWithError(w, 401, "Unauthorized!")
+		return
+	}
+	query, limit, err := parseFeedPage(r.URL.Query())
+	if err != nil {
+		respondWithError(w, 400, err.Error())
+		return
+	}
+	chirps, err := cfg.db.GetTimeline(userId, query)
 	if err != nil {
-		respondWithError(w, 500, "Something went wrong with the DB!")
+		respondWithDBError(w, err)
 		return
 	}
-	dbStructure, err := db.LoadDB()
+	cfg.respondWithChirpPage(w, r, chirps, limit, userId)
+}
+
+// respondWithChirpPage answers with the first limit chirps, queried
+// with one more to tell whether the Link header should point at a
+// next page
+func (cfg *apiConfig) respondWithChirpPage(w http.ResponseWriter, r *http.Request, chirps []database.Chirp, limit int, userId int) {
+	if limit > 0 && len(chirps) > limit {
+		chirps = chirps[:limit]
+		last := chirps[limit-1]
+		setNextLink(w, r, pageCursor{CreatedAt: last.CreatedAt, Id: last.Id})
+	}
+	response, err := cfg.renderChirps(chirps, userId)
 	if err != nil {
-		respondWithError(w, 500, "Something went wrong with the DB loading!")
+		respondWithDBError(w, err)
 		return
 	}
+	respondWithJSON(w, 200, response)
+}
+
+// chirpResponse is a chirp as answered with: with its likes as seen by
+// the user asking for it and the chirp it reshares, if any, inline
+type chirpResponse struct {
+	database.Chirp
+	database.ChirpLikes
+	RefChirp *database.Chirp `json:"ref_chirp,omitempty"`
+}
+
+// renderChirps turns chirps into responses for userId,
+// which is 0 for someone who isn't logged in
+func (cfg *apiConfig) renderChirps(chirps []database.Chirp, userId int) ([]chirpResponse, error) {
+	chirpIds := make([]int, len(chirps))
+	for i, chirp := range chirps {
+		chirpIds[i] = chirp.Id
+	}
+	likes, err := cfg.db.GetChirpLikes(chirpIds, userId)
+	if err != nil {
+		return nil, err
+	}
+	refChirps, err := cfg.db.GetRefChirps(chirps, userId)
+	if err != nil {
+		return nil, err
+	}
+	response := make([]chirpResponse, len(chirps))
+	for i, chirp := range chirps {
+		response[i] = chirpResponse{Chirp: chirp, ChirpLikes: likes[chirp.Id]}
+		if refChirp, ok := refChirps[chirp.RefChirpId]; ok {
+			response[i].RefChirp = &refChirp
+		}
+	}
+	return response, nil
+}
+
+// chirpGetter is satisfied by both database.Store and database.Tx
+type chirpGetter interface {
+	GetChirp(id int) (database.Chirp, error)
+	GetChirpByUid(uid string) (database.Chirp, error)
+}
+
+// resolveChirp loads the chirp named by an {id} URL parameter,
+// which is either its integer id or its uid
+func resolveChirp(db chirpGetter, id string) (database.Chirp, error) {
 	idInt, err := strconv.Atoi(id)
 	if err != nil {
-		respondWithError(w, 500, "Something went wrong!")
+		return db.GetChirpByUid(id)
+	}
+	return db.GetChirp(idInt)
+}
+
+// resolveVisibleChirp is resolveChirp for userId, 0 for someone who
+// isn't logged in. Chirps they may not see are not found rather than
+// forbidden, so their existence isn't given away.
+func (cfg *apiConfig) resolveVisibleChirp(id string, userId int) (database.Chirp, error) {
+	chirp, err := resolveChirp(cfg.db, id)
+	if err != nil {
+		return database.Chirp{}, err
+	}
+	ok, err := cfg.db.CanSeeChirp(chirp, userId)
+	if err != nil {
+		return database.Chirp{}, err
+	}
+	if !ok {
+		return database.Chirp{}, database.ErrNotFound
+	}
+	return chirp, nil
+}
+
+func (cfg *apiConfig) handlerGetChirpWithId(w http.ResponseWriter, r *http.Request) {
+	userId, err := cfg.authenticateOptional(r)
+	if err != nil {
+		log.Print(err.Error())
+		respondWithError(w, 401, "Unauthorized!")
 		return
 	}
-	if chirp, ok := dbStructure.Chirps[idInt]; ok {
-		respondWithJSON(w, 200, chirp)
+	chirp, err := cfg.resolveVisibleChirp(chi.URLParam(r, "id"), userId)
+	if err != nil {
+		respondWithDBError(w, err)
+		return
+	}
+	response, err := cfg.renderChirps([]database.Chirp{chirp}, userId)
+	if err != nil {
+		respondWithDBError(w, err)
 		return
-	} else {
-		respondWithError(w, 404, "Not found!")
 	}
+	respondWithJSON(w, 200, response[0])
 }
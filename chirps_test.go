@@ -0,0 +1,66 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http/httptest"
+	"path/filepath"
+	"testing"
+
+	"github.com/aliasboink/go_web_server/internal/database"
+)
+
+// newTestConfig returns an apiConfig on a fresh JSON store
+func newTestConfig(t *testing.T) *apiConfig {
+	t.Helper()
+	db, err := database.Open(database.Config{Driver: "json", Path: filepath.Join(t.TempDir(), "database.json")})
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() {
+		db.Close()
+	})
+	return &apiConfig{jwtSecret: "secret", db: db}
+}
+
+func TestGetChirpsAuthorId(t *testing.T) {
+	cfg := newTestConfig(t)
+	_, err := cfg.db.CreateUser("walt@example.com", "hash")
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = cfg.db.CreateChirp("hello", "1")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		authorId string
+		code     int
+		error    string
+	}{
+		{"1", 200, ""},
+		{"2", 200, ""},
+		{"walt", 400, "Invalid author id!"},
+		{"1.5", 400, "Invalid author id!"},
+	}
+	for _, test := range tests {
+		w := httptest.NewRecorder()
+		cfg.handlerGetChirps(w, httptest.NewRequest("GET", "/api/chirps?author_id="+test.authorId, nil))
+		if w.Code != test.code {
+			t.Fatalf("author_id=%s: got status %d, want %d", test.authorId, w.Code, test.code)
+		}
+		if test.error == "" {
+			continue
+		}
+		var body struct {
+			Error string `json:"error"`
+		}
+		err := json.Unmarshal(w.Body.Bytes(), &body)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if body.Error != test.error {
+			t.Fatalf("author_id=%s: got error %q, want %q", test.authorId, body.Error, test.error)
+		}
+	}
+}
@@ -0,0 +1,134 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"os"
+
+	"github.com/aliasboink/go_web_server/internal/database"
+	"github.com/aliasboink/go_web_server/internal/moderation"
+)
+
+// runCommand runs one of the maintenance subcommands
+// instead of starting the server
+func runCommand(dbConfig database.Config, args []string) error {
+	switch args[0] {
+	case "migrate":
+		return commandMigrate(dbConfig)
+	case "backup":
+		if len(args) != 2 {
+			return errors.New("Usage: backup <file>")
+		}
+		return commandBackup(dbConfig, args[1])
+	case "restore":
+		if len(args) != 2 {
+			return errors.New("Usage: restore <file>")
+		}
+		return commandRestore(dbConfig, args[1])
+	case "reindex":
+		return commandReindex(dbConfig)
+	case "import-profanities":
+		if len(args) != 2 {
+			return errors.New("Usage: import-profanities <file>")
+		}
+		return commandImportProfanities(dbConfig, args[1])
+	}
+	return fmt.Errorf("Unknown command %q!", args[0])
+}
+
+func commandMigrate(dbConfig database.Config) error {
+	from, backup, err := database.Migrate(dbConfig)
+	if err != nil {
+		return err
+	}
+	if backup == "" {
+		log.Printf("%s is already at schema version %d", dbConfig.Path, from)
+		return nil
+	}
+	log.Printf("Migrated %s from schema version %d to %d, backup at %s", dbConfig.Path, from, database.SchemaVersion(), backup)
+	return nil
+}
+
+func commandBackup(dbConfig database.Config, path string) error {
+	file, err := os.OpenFile(path, os.O_CREATE|os.O_EXCL|os.O_WRONLY, 0666)
+	if err != nil {
+		return err
+	}
+	err = database.Backup(dbConfig, file)
+	if err != nil {
+		file.Close()
+		os.Remove(path)
+		return err
+	}
+	err = file.Close()
+	if err != nil {
+		return err
+	}
+	log.Printf("Backed up %s to %s", dbConfig.Path, path)
+	return nil
+}
+
+func commandRestore(dbConfig database.Config, path string) error {
+	file, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+	err = database.Restore(dbConfig, file)
+	if err != nil {
+		return err
+	}
+	log.Printf("Restored %s from %s", dbConfig.Path, path)
+	return nil
+}
+
+func commandReindex(dbConfig database.Config) error {
+	db, err := database.Open(dbConfig)
+	if err != nil {
+		return err
+	}
+	indexed, err := db.RebuildSearchIndex()
+	if err != nil {
+		db.Close()
+		return err
+	}
+	err = db.Close()
+	if err != nil {
+		return err
+	}
+	log.Printf("Rebuilt the search index of %s from %d chirps", dbConfig.Path, indexed)
+	return nil
+}
+
+// commandImportProfanities replaces the profanity list with the word
+// list at path, as read by moderation.ParseRules
+func commandImportProfanities(dbConfig database.Config, path string) error {
+	rules, err := moderation.LoadFile(path)
+	if err != nil {
+		return err
+	}
+	_, err = moderation.NewFilter(rules)
+	if err != nil {
+		return err
+	}
+	words := make([]database.BannedWord, len(rules))
+	for i, rule := range rules {
+		words[i] = database.BannedWord{Word: rule.Word, Action: string(rule.Action)}
+	}
+	db, err := database.Open(dbConfig)
+	if err != nil {
+		return err
+	}
+	err = db.ReplaceBannedWords(words)
+	if err != nil {
+		db.Close()
+		return err
+	}
+	err = db.Close()
+	if err != nil {
+		return err
+	}
+	log.Printf("Imported %d words from %s into the profanity list of %s", len(words), path, dbConfig.Path)
+	return nil
+}
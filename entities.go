@@ -0,0 +1,72 @@
+package main
+
+import (
+	"log"
+	"net/http"
+
+	"github.com/aliasboink/go_web_server/internal/database"
+	"github.com/go-chi/chi/v5"
+)
+
+// handlerGetHashtagChirps lists the chirps tagged with {tag}, whatever
+// its case, newest first and paged like handlerGetTimeline
+func (cfg *apiConfig) handlerGetHashtagChirps(w http.ResponseWriter, r *http.Request) {
+	userId, err := cfg.authenticateOptional(r)
+	if err != nil {
+		log.Print(err.Error())
+		respondWithError(w, 401, "Unauthorized!")
+		return
+	}
+	query, limit, err := parseFeedPage(r.URL.Query())
+	if err != nil {
+		respondWithError(w, 400, err.Error())
+		return
+	}
+	query.Hashtag = chi.URLParam(r, "tag")
+	query.MutedBy = userId
+	query.ViewerId = userId
+	chirps, err := cfg.db.QueryChirps(query)
+	if err != nil {
+		respondWithDBError(w, err)
+		return
+	}
+	cfg.respondWithChirpPage(w, r, chirps, limit, userId)
+}
+
+// handlerGetUserMentions lists the chirps mentioning a user,
+// newest first and paged like handlerGetTimeline
+func (cfg *apiConfig) handlerGetUserMentions(w http.ResponseWriter, r *http.Request) {
+	viewerId, err := cfg.authenticateOptional(r)
+	if err != nil {
+		log.Print(err.Error())
+		respondWithError(w, 401, "Unauthorized!")
+		return
+	}
+	userId, err := userIdParam(r)
+	if err != nil {
+		respondWithError(w, 400, "Invalid user id!")
+		return
+	}
+	query, limit, err := parseFeedPage(r.URL.Query())
+	if err != nil {
+		respondWithError(w, 400, err.Error())
+		return
+	}
+	query.MentionOf = userId
+	query.MutedBy = viewerId
+	query.ViewerId = viewerId
+	var chirps []database.Chirp
+	err = cfg.db.View(func(tx database.Tx) error {
+		_, err := tx.GetUser(userId)
+		if err != nil {
+			return err
+		}
+		chirps, err = tx.QueryChirps(query)
+		return err
+	})
+	if err != nil {
+		respondWithDBError(w, err)
+		return
+	}
+	cfg.respondWithChirpPage(w, r, chirps, limit, viewerId)
+}
@@ -0,0 +1,41 @@
+package main
+
+import (
+	"errors"
+	"log"
+	"net/http"
+
+	"github.com/aliasboink/go_web_server/internal/database"
+)
+
+// statusForError returns the HTTP status an error from the
+// database package should be answered with
+func statusForError(err error) int {
+	switch {
+	case errors.Is(err, database.ErrNotFound):
+		return 404
+	case errors.Is(err, database.ErrForbidden), errors.Is(err, database.ErrBlocked):
+		return 403
+	case errors.Is(err, database.ErrDuplicateEmail), errors.Is(err, database.ErrRechirped),
+		errors.Is(err, database.ErrReported), errors.Is(err, database.ErrResolved):
+		return 409
+	case errors.Is(err, database.ErrRevoked):
+		return 401
+	case errors.Is(err, database.ErrNoParent), errors.Is(err, database.ErrSelfFollow),
+		errors.Is(err, database.ErrSelfBlock):
+		return 422
+	}
+	return 500
+}
+
+// respondWithDBError answers with the status matching err, only
+// passing its message on for the errors the database package exports
+func respondWithDBError(w http.ResponseWriter, err error) {
+	code := statusForError(err)
+	if code == 500 {
+		log.Print(err.Error())
+		respondWithError(w, 500, "Something went wrong with the DB!")
+		return
+	}
+	respondWithError(w, code, err.Error())
+}
@@ -0,0 +1,100 @@
+package main
+
+import (
+	"log"
+	"net/http"
+	"strconv"
+
+	"github.com/aliasboink/go_web_server/internal/database"
+	"github.com/go-chi/chi/v5"
+)
+
+// publicUser is what anyone may see of a user
+type publicUser struct {
+	Id          int    `json:"id"`
+	Uid         string `json:"uid,omitempty"`
+	IsChirpyRed bool   `json:"is_chirpy_red"`
+}
+
+func publicUsers(users []database.User) []publicUser {
+	response := make([]publicUser, len(users))
+	for i, user := range users {
+		response[i] = publicUser{Id: user.Id, Uid: user.Uid, IsChirpyRed: user.IsChirpyRed}
+	}
+	return response
+}
+
+// userIdParam reads the {id} URL parameter of the /users/{id} routes
+func userIdParam(r *http.Request) (int, error) {
+	return strconv.Atoi(chi.URLParam(r, "id"))
+}
+
+func (cfg *apiConfig) handlerPostFollow(w http.ResponseWriter, r *http.Request) {
+	userId, err := cfg.authenticate(r)
+	if err != nil {
+		log.Print(err.Error())
+		respondWithError(w, 401, "Unauthorized!")
+		return
+	}
+	followeeId, err := userIdParam(r)
+	if err != nil {
+		respondWithError(w, 400, "Invalid user id!")
+		return
+	}
+	err = cfg.db.FollowUser(userId, followeeId)
+	if err != nil {
+		respondWithDBError(w, err)
+		return
+	}
+	w.WriteHeader(204)
+}
+
+func (cfg *apiConfig) handlerDeleteFollow(w http.ResponseWriter, r *http.Request) {
+	userId, err := cfg.authenticate(r)
+	if err != nil {
+		log.Print(err.Error())
+		respondWithError(w, 401, "Unauthorized!")
+		return
+	}
+	followeeId, err := userIdParam(r)
+	if err != nil {
+		respondWithError(w, 400, "Invalid user id!")
+		return
+	}
+	err = cfg.db.UnfollowUser(userId, followeeId)
+	if err != nil {
+		respondWithDBError(w, err)
+		return
+	}
+	w.WriteHeader(204)
+}
+
+// handlerGetFollowers lists who follows a user, newest follower first
+func (cfg *apiConfig) handlerGetFollowers(w http.ResponseWriter, r *http.Request) {
+	userId, err := userIdParam(r)
+	if err != nil {
+		respondWithError(w, 400, "Invalid user id!")
+		return
+	}
+	users, err := cfg.db.GetFollowers(userId)
+	if err != nil {
+		respondWithDBError(w, err)
+		return
+	}
+	respondWithJSON(w, 200, publicUsers(users))
+}
+
+// handlerGetFollowing lists who a user follows, most recently followed first
+func (cfg *apiConfig) handlerGetFollowing(w http.ResponseWriter, r *http.Request) {
+	userId, err := userIdParam(r)
+	if err != nil {
+		respondWithError(w, 400, "Invalid user id!")
+		return
+	}
+	users, err := cfg.db.GetFollowing(userId)
+	if err != nil {
+		respondWithDBError(w, err)
+		return
+	}
+	respondWithJSON(w, 200, publicUsers(users))
+}
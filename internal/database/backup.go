@@ -0,0 +1,268 @@
+package database
+
+import (
+	"bytes"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+)
+
+// Backup writes a consistent point-in-time snapshot of the database to w.
+// The data is marshalled under the lock and written out after releasing
+// it, so a slow reader doesn't hold up writers.
+func (db *DB) Backup(w io.Writer) error {
+	db.mux.RLock()
+	dbStructureBytes, err := json.MarshalIndent(db.data, "", "  ")
+	db.mux.RUnlock()
+	if err != nil {
+		return err
+	}
+	_, err = w.Write(dbStructureBytes)
+	return err
+}
+
+// Backup writes a consistent point-in-time snapshot of the database to w
+// using VACUUM INTO, which runs inside a read transaction.
+func (s *SQLiteDB) Backup(w io.Writer) error {
+	dir, err := os.MkdirTemp(filepath.Dir(s.path), ".snapshot-*")
+	if err != nil {
+		return err
+	}
+	defer os.RemoveAll(dir)
+	snapshotPath := filepath.Join(dir, "snapshot.sqlite")
+	_, err = s.db.Exec("VACUUM INTO ?", snapshotPath)
+	if err != nil {
+		return err
+	}
+	file, err := os.Open(snapshotPath)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+	_, err = io.Copy(w, file)
+	return err
+}
+
+// backupAttempts is how many times Backup reads a JSON database that
+// keeps changing under it before giving up
+const backupAttempts = 5
+
+// Backup writes a snapshot of the database described by cfg to w without
+// modifying it. For the JSON store any journal entries are applied to
+// the snapshot in memory only. A server writing the file and journal
+// while they are read would leave them out of step, so they are read
+// again until nothing changed in between. A busy server may never
+// allow that, POST /admin/snapshot is the way to back it up.
+func Backup(cfg Config, w io.Writer) error {
+	switch cfg.Driver {
+	case "", "json":
+		db := &DB{path: cfg.Path}
+		for attempt := 0; ; attempt++ {
+			if attempt == backupAttempts {
+				return fmt.Errorf("Database %s kept changing while backing it up, use POST /admin/snapshot on the server instead!", cfg.Path)
+			}
+			fileBefore, journalBefore, err := db.readFiles()
+			if err != nil {
+				return err
+			}
+			db.data, err = db.readDB()
+			if err != nil {
+				return err
+			}
+			entries, err := db.readJournal()
+			if err != nil {
+				return err
+			}
+			fileAfter, journalAfter, err := db.readFiles()
+			if err != nil {
+				return err
+			}
+			if !bytes.Equal(fileBefore, fileAfter) || !bytes.Equal(journalBefore, journalAfter) {
+				continue
+			}
+			err = checkVersion(cfg.Path, db.data.Version)
+			if err != nil {
+				return err
+			}
+			for _, entry := range entries {
+				err = entry.apply(&db.data)
+				if err != nil {
+					return err
+				}
+			}
+			break
+		}
+		dbStructureBytes, err := json.MarshalIndent(db.data, "", "  ")
+		if err != nil {
+			return err
+		}
+		_, err = w.Write(dbStructureBytes)
+		return err
+	case "sqlite":
+		_, err := os.Stat(cfg.Path)
+		if err != nil {
+			return err
+		}
+		s, err := NewSQLiteDB(cfg.Path)
+		if err != nil {
+			return err
+		}
+		defer s.Close()
+		return s.Backup(w)
+	}
+	return fmt.Errorf("Unknown database driver %q!", cfg.Driver)
+}
+
+// Restore replaces the database described by cfg with the snapshot read
+// from r. The snapshot is written next to the database and validated
+// first, then renamed over it, so a bad snapshot never replaces good data.
+// The server must not be running while restoring.
+func Restore(cfg Config, r io.Reader) error {
+	dir := filepath.Dir(cfg.Path)
+	tmp, err := os.CreateTemp(dir, filepath.Base(cfg.Path)+".restore-*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+	_, err = io.Copy(tmp, r)
+	if err != nil {
+		tmp.Close()
+		return err
+	}
+	err = tmp.Sync()
+	if err != nil {
+		tmp.Close()
+		return err
+	}
+	err = tmp.Close()
+	if err != nil {
+		return err
+	}
+
+	switch cfg.Driver {
+	case "", "json":
+		err = validateJSONSnapshot(tmp.Name())
+		if err != nil {
+			return err
+		}
+		// The journal belongs to the data being replaced. It goes
+		// first, a crash before the rename must not leave it to be
+		// replayed onto the restored data.
+		err = os.Remove(cfg.Path + ".journal")
+		if err != nil && !errors.Is(err, os.ErrNotExist) {
+			return err
+		}
+		err = syncDir(dir)
+		if err != nil {
+			return err
+		}
+		err = os.Rename(tmp.Name(), cfg.Path)
+		if err != nil {
+			return err
+		}
+		return syncDir(dir)
+	case "sqlite":
+		err = validateSQLiteSnapshot(tmp.Name())
+		if err != nil {
+			return err
+		}
+		// Stale WAL files would be replayed into the restored database.
+		for _, suffix := range []string{"-wal", "-shm"} {
+			err = os.Remove(cfg.Path + suffix)
+			if err != nil && !errors.Is(err, os.ErrNotExist) {
+				return err
+			}
+		}
+		err = os.Rename(tmp.Name(), cfg.Path)
+		if err != nil {
+			return err
+		}
+		return syncDir(dir)
+	}
+	return fmt.Errorf("Unknown database driver %q!", cfg.Driver)
+}
+
+// readFiles returns the raw contents of the database file and of its
+// journal, which may not exist
+func (db *DB) readFiles() ([]byte, []byte, error) {
+	fileBytes, err := os.ReadFile(db.path)
+	if err != nil {
+		return nil, nil, err
+	}
+	journalBytes, err := os.ReadFile(db.journalPath())
+	if err != nil && !errors.Is(err, os.ErrNotExist) {
+		return nil, nil, err
+	}
+	return fileBytes, journalBytes, nil
+}
+
+// validateJSONSnapshot checks that path holds a complete JSON database
+// of the current schema version whose records agree with their keys
+func validateJSONSnapshot(path string) error {
+	snapshotBytes, err := os.ReadFile(path)
+	if err != nil {
+		return err
+	}
+	decoder := json.NewDecoder(bytes.NewReader(snapshotBytes))
+	decoder.DisallowUnknownFields()
+	var dbStructure DBStructure
+	err = decoder.Decode(&dbStructure)
+	if err != nil {
+		return fmt.Errorf("Snapshot is not a valid JSON database: %w", err)
+	}
+	err = checkVersion(path, dbStructure.Version)
+	if err != nil {
+		return err
+	}
+	for id, chirp := range dbStructure.Chirps {
+		if chirp.Id != id {
+			return fmt.Errorf("Snapshot chirp %d is stored under id %d!", chirp.Id, id)
+		}
+	}
+	for id, user := range dbStructure.Users {
+		if user.Id != id {
+			return fmt.Errorf("Snapshot user %d is stored under id %d!", user.Id, id)
+		}
+	}
+	for id, report := range dbStructure.Reports {
+		if report.Id != id {
+			return fmt.Errorf("Snapshot report %d is stored under id %d!", report.Id, id)
+		}
+	}
+	for id, versions := range dbStructure.History {
+		for _, version := range versions {
+			if version.ChirpId != id {
+				return fmt.Errorf("Snapshot history of chirp %d holds a version of chirp %d!", id, version.ChirpId)
+			}
+		}
+	}
+	return nil
+}
+
+// validateSQLiteSnapshot checks that path holds an intact SQLite
+// database of the current schema version
+func validateSQLiteSnapshot(path string) error {
+	db, err := sql.Open("sqlite3", path+"?mode=ro")
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+	var result string
+	err = db.QueryRow("PRAGMA integrity_check").Scan(&result)
+	if err != nil {
+		return fmt.Errorf("Snapshot is not a valid SQLite database: %w", err)
+	}
+	if result != "ok" {
+		return fmt.Errorf("Snapshot failed the integrity check: %s", result)
+	}
+	var version int
+	err = db.QueryRow("PRAGMA user_version").Scan(&version)
+	if err != nil {
+		return err
+	}
+	return checkVersion(path, version)
+}
@@ -0,0 +1,73 @@
+package database
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestBackupRestore(t *testing.T) {
+	for name, db := range openStores(t) {
+		t.Run(name, func(t *testing.T) {
+			_, err := db.CreateChirp("backed up", "1")
+			if err != nil {
+				t.Fatal(err)
+			}
+			var snapshot bytes.Buffer
+			err = db.Backup(&snapshot)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			cfg := Config{Driver: name, Path: filepath.Join(t.TempDir(), "restored")}
+			err = Restore(cfg, &snapshot)
+			if err != nil {
+				t.Fatal(err)
+			}
+			restored, err := Open(cfg)
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer restored.Close()
+			chirp, err := restored.GetChirp(1)
+			if err != nil || chirp.Body != "backed up" {
+				t.Fatalf("chirp missing from restored database: %+v, %v", chirp, err)
+			}
+		})
+	}
+}
+
+func TestRestoreRejectsBadSnapshot(t *testing.T) {
+	for _, driver := range []string{"json", "sqlite"} {
+		t.Run(driver, func(t *testing.T) {
+			cfg := Config{Driver: driver, Path: filepath.Join(t.TempDir(), "database")}
+			db, err := Open(cfg)
+			if err != nil {
+				t.Fatal(err)
+			}
+			_, err = db.CreateChirp("keep me", "1")
+			if err != nil {
+				t.Fatal(err)
+			}
+			db.Close()
+			before, err := os.ReadFile(cfg.Path)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			err = Restore(cfg, strings.NewReader(`{"chirps":{"1":{"id":1,"bo`))
+			if err == nil {
+				t.Fatal("restored a truncated snapshot")
+			}
+			after, err := os.ReadFile(cfg.Path)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !bytes.Equal(before, after) {
+				t.Fatal("failed restore modified the database")
+			}
+		})
+	}
+}
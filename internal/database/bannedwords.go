@@ -0,0 +1,160 @@
+package database
+
+import (
+	"errors"
+	"sort"
+	"strings"
+	"time"
+)
+
+// BannedWord is a word of the profanity list and what to do with chirps
+// containing it, as understood by the moderation package. Words are
+// stored lowercase, a word is on the list at most once.
+type BannedWord struct {
+	Word      string    `json:"word"`
+	Action    string    `json:"action"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// defaultBannedWords is the list new databases start with
+var defaultBannedWords = []string{"kerfuffle", "sharbert", "fornax"}
+
+// seedBannedWords returns the list new databases start with, all masked
+func seedBannedWords(now time.Time) []BannedWord {
+	words := make([]BannedWord, len(defaultBannedWords))
+	for i, word := range defaultBannedWords {
+		words[i] = BannedWord{Word: word, Action: "mask", CreatedAt: now}
+	}
+	return words
+}
+
+// sortBannedWords orders words alphabetically
+func sortBannedWords(words []BannedWord) {
+	sort.Slice(words, func(i, j int) bool {
+		return words[i].Word < words[j].Word
+	})
+}
+
+// GetBannedWords returns the profanity list, alphabetically
+func (s txStore) GetBannedWords() ([]BannedWord, error) {
+	var words []BannedWord
+	err := s.backend.View(func(tx Tx) error {
+		var err error
+		words, err = tx.GetBannedWords()
+		return err
+	})
+	return words, err
+}
+
+// AddBannedWord puts a word on the profanity list, or changes the
+// action for it if it is already there
+func (s txStore) AddBannedWord(word string, action string) (BannedWord, error) {
+	bannedWord := BannedWord{Word: strings.ToLower(word), Action: action, CreatedAt: time.Now().UTC()}
+	err := s.backend.Update(func(tx Tx) error {
+		old, err := tx.GetBannedWord(bannedWord.Word)
+		if err == nil {
+			bannedWord.CreatedAt = old.CreatedAt
+		} else if !errors.Is(err, ErrNotFound) {
+			return err
+		}
+		return tx.PutBannedWord(bannedWord)
+	})
+	if err != nil {
+		return BannedWord{}, err
+	}
+	return bannedWord, nil
+}
+
+// RemoveBannedWord takes a word off the profanity list
+func (s txStore) RemoveBannedWord(word string) error {
+	return s.backend.Update(func(tx Tx) error {
+		_, err := tx.GetBannedWord(strings.ToLower(word))
+		if err != nil {
+			return err
+		}
+		return tx.DeleteBannedWord(strings.ToLower(word))
+	})
+}
+
+// ReplaceBannedWords swaps the whole profanity list for words, keeping
+// when the words already on it were added
+func (s txStore) ReplaceBannedWords(words []BannedWord) error {
+	return s.backend.Update(func(tx Tx) error {
+		old, err := tx.GetBannedWords()
+		if err != nil {
+			return err
+		}
+		addedAt := make(map[string]time.Time, len(old))
+		for _, bannedWord := range old {
+			addedAt[bannedWord.Word] = bannedWord.CreatedAt
+			err = tx.DeleteBannedWord(bannedWord.Word)
+			if err != nil {
+				return err
+			}
+		}
+		now := time.Now().UTC()
+		for _, bannedWord := range words {
+			bannedWord.Word = strings.ToLower(bannedWord.Word)
+			bannedWord.CreatedAt = now
+			if createdAt, ok := addedAt[bannedWord.Word]; ok {
+				bannedWord.CreatedAt = createdAt
+			}
+			err = tx.PutBannedWord(bannedWord)
+			if err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+// CensorChirps runs the body of every chirp, and every earlier version
+// of it, through censor and stores what comes out. Censoring isn't an
+// edit, so it leaves no new versions and updated_at alone. It returns
+// how many chirps changed.
+func (s txStore) CensorChirps(censor func(body string) string) (int, error) {
+	censored := 0
+	err := s.backend.Update(func(tx Tx) error {
+		censored = 0
+		chirps, err := tx.GetChirps()
+		if err != nil {
+			return err
+		}
+		for _, chirp := range chirps {
+			changed := false
+			versions, err := tx.GetChirpVersions(chirp.Id)
+			if err != nil {
+				return err
+			}
+			for _, version := range versions {
+				body := censor(version.Body)
+				if body == version.Body {
+					continue
+				}
+				version.Body = body
+				err = tx.PutChirpVersion(version)
+				if err != nil {
+					return err
+				}
+				changed = true
+			}
+			if body := censor(chirp.Body); body != chirp.Body {
+				chirp.Body = body
+				chirp.Entities, err = chirpEntities(tx, body)
+				if err != nil {
+					return err
+				}
+				err = tx.PutChirp(chirp)
+				if err != nil {
+					return err
+				}
+				changed = true
+			}
+			if changed {
+				censored++
+			}
+		}
+		return nil
+	})
+	return censored, err
+}
@@ -0,0 +1,89 @@
+package database
+
+import (
+	"errors"
+	"strings"
+	"testing"
+)
+
+func TestBannedWords(t *testing.T) {
+	for name, db := range openStores(t) {
+		t.Run(name, func(t *testing.T) {
+			words, err := db.GetBannedWords()
+			if err != nil || len(words) != 3 || words[0].Word != "fornax" || words[0].Action != "mask" {
+				t.Fatalf("got %+v, %v, want the built in list", words, err)
+			}
+
+			added, err := db.AddBannedWord("Heisenberg", "reject")
+			if err != nil || added.Word != "heisenberg" {
+				t.Fatalf("got %+v, %v", added, err)
+			}
+			changed, err := db.AddBannedWord("heisenberg", "flag")
+			if err != nil || changed.Action != "flag" || !changed.CreatedAt.Equal(added.CreatedAt) {
+				t.Fatalf("got %+v, %v, want the action changed and the word kept", changed, err)
+			}
+			err = db.RemoveBannedWord("Sharbert")
+			if err != nil {
+				t.Fatal(err)
+			}
+			err = db.RemoveBannedWord("sharbert")
+			if !errors.Is(err, ErrNotFound) {
+				t.Fatalf("got %v, want ErrNotFound", err)
+			}
+			words, err = db.GetBannedWords()
+			if err != nil || len(words) != 3 || words[1].Word != "heisenberg" || words[1].Action != "flag" {
+				t.Fatalf("got %+v, %v", words, err)
+			}
+
+			err = db.ReplaceBannedWords([]BannedWord{{Word: "Pinkman", Action: "mask"}, {Word: "fornax", Action: "reject"}})
+			if err != nil {
+				t.Fatal(err)
+			}
+			words, err = db.GetBannedWords()
+			if err != nil || len(words) != 2 || words[0].Word != "fornax" || words[0].Action != "reject" || words[1].Word != "pinkman" {
+				t.Fatalf("got %+v, %v", words, err)
+			}
+		})
+	}
+}
+
+func TestCensorChirps(t *testing.T) {
+	for name, db := range openStores(t) {
+		t.Run(name, func(t *testing.T) {
+			chirp, err := db.CreateChirp("Yo pinkman #pinkman", "1")
+			if err != nil {
+				t.Fatal(err)
+			}
+			edited, err := db.EditChirp(chirp.Id, 1, "Yo Jesse #pinkman")
+			if err != nil {
+				t.Fatal(err)
+			}
+			_, err = db.CreateChirp("Say my name", "1")
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			censored, err := db.CensorChirps(func(body string) string {
+				return strings.ReplaceAll(body, "pinkman", "****")
+			})
+			if err != nil || censored != 1 {
+				t.Fatalf("censored %d chirps, %v, want 1", censored, err)
+			}
+			chirp, err = db.GetChirp(chirp.Id)
+			if err != nil || chirp.Body != "Yo Jesse #****" || !chirp.UpdatedAt.Equal(edited.UpdatedAt) {
+				t.Fatalf("got %+v, %v", chirp, err)
+			}
+			if len(chirp.Entities) != 0 {
+				t.Fatalf("got entities %+v, want the hashtag gone", chirp.Entities)
+			}
+			history, err := db.GetChirpHistory(chirp.Id)
+			if err != nil || len(history) != 2 || history[0].Body != "Yo **** #****" {
+				t.Fatalf("got %+v, %v, want the earlier version censored too", history, err)
+			}
+			found, err := db.SearchChirps(SearchQuery{Text: "pinkman"})
+			if err != nil || len(found) != 0 {
+				t.Fatalf("got %+v, %v, want the censored word out of the search index", found, err)
+			}
+		})
+	}
+}
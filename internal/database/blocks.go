@@ -0,0 +1,151 @@
+package database
+
+import (
+	"errors"
+	"time"
+)
+
+// Block records that a user blocked another. Blocked users can't
+// reply to, mention, like or follow the user who blocked them.
+type Block struct {
+	BlockerId int       `json:"blocker_id"`
+	BlockedId int       `json:"blocked_id"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// Mute records that a user muted another. The chirps of muted users
+// are left out of what QueryChirps returns for the user who muted
+// them when ChirpQuery.MutedBy asks for it.
+type Mute struct {
+	MuterId   int       `json:"muter_id"`
+	MutedId   int       `json:"muted_id"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// checkBlocked fails with ErrBlocked if byUserId blocked userId
+func checkBlocked(tx Tx, userId int, byUserId int) error {
+	_, err := tx.GetBlock(byUserId, userId)
+	if err == nil {
+		return ErrBlocked
+	}
+	if errors.Is(err, ErrNotFound) {
+		return nil
+	}
+	return err
+}
+
+// checkMentions fails with ErrBlocked if any user mentioned
+// in entities blocked authorId
+func checkMentions(tx Tx, authorId int, entities Entities) error {
+	for _, entity := range entities {
+		if entity.Kind != EntityMention {
+			continue
+		}
+		err := checkBlocked(tx, authorId, entity.UserId)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// BlockUser makes blockerId block blockedId, blocking again changes
+// nothing. The blocked user stops following the blocker.
+func (s txStore) BlockUser(blockerId int, blockedId int) error {
+	if blockerId == blockedId {
+		return ErrSelfBlock
+	}
+	return s.backend.Update(func(tx Tx) error {
+		_, err := tx.GetUser(blockedId)
+		if err != nil {
+			return err
+		}
+		_, err = tx.GetFollow(blockedId, blockerId)
+		if err == nil {
+			err = tx.DeleteFollow(blockedId, blockerId)
+		} else if errors.Is(err, ErrNotFound) {
+			err = nil
+		}
+		if err != nil {
+			return err
+		}
+		_, err = tx.GetBlock(blockerId, blockedId)
+		if !errors.Is(err, ErrNotFound) {
+			return err
+		}
+		return tx.PutBlock(Block{BlockerId: blockerId, BlockedId: blockedId, CreatedAt: time.Now().UTC()})
+	})
+}
+
+// UnblockUser takes back the block of blockerId on blockedId, if there is one
+func (s txStore) UnblockUser(blockerId int, blockedId int) error {
+	return s.backend.Update(func(tx Tx) error {
+		_, err := tx.GetUser(blockedId)
+		if err != nil {
+			return err
+		}
+		_, err = tx.GetBlock(blockerId, blockedId)
+		if errors.Is(err, ErrNotFound) {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		return tx.DeleteBlock(blockerId, blockedId)
+	})
+}
+
+// MuteUser makes muterId mute mutedId, muting again changes nothing
+func (s txStore) MuteUser(muterId int, mutedId int) error {
+	if muterId == mutedId {
+		return ErrSelfBlock
+	}
+	return s.backend.Update(func(tx Tx) error {
+		_, err := tx.GetUser(mutedId)
+		if err != nil {
+			return err
+		}
+		_, err = tx.GetMute(muterId, mutedId)
+		if !errors.Is(err, ErrNotFound) {
+			return err
+		}
+		return tx.PutMute(Mute{MuterId: muterId, MutedId: mutedId, CreatedAt: time.Now().UTC()})
+	})
+}
+
+// UnmuteUser takes back the mute of muterId on mutedId, if there is one
+func (s txStore) UnmuteUser(muterId int, mutedId int) error {
+	return s.backend.Update(func(tx Tx) error {
+		_, err := tx.GetUser(mutedId)
+		if err != nil {
+			return err
+		}
+		_, err = tx.GetMute(muterId, mutedId)
+		if errors.Is(err, ErrNotFound) {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		return tx.DeleteMute(muterId, mutedId)
+	})
+}
+
+// putPair stores at under first and second in pairs
+func putPair(pairs map[int]map[int]time.Time, first int, second int, at time.Time) {
+	inner, ok := pairs[first]
+	if !ok {
+		inner = make(map[int]time.Time)
+		pairs[first] = inner
+	}
+	inner[second] = at
+}
+
+// deletePair removes second from the pairs under first, dropping them once empty
+func deletePair(pairs map[int]map[int]time.Time, first int, second int) {
+	inner := pairs[first]
+	delete(inner, second)
+	if len(inner) == 0 {
+		delete(pairs, first)
+	}
+}
@@ -0,0 +1,180 @@
+package database
+
+import (
+	"errors"
+	"strconv"
+	"testing"
+)
+
+func TestBlocks(t *testing.T) {
+	for name, db := range openStores(t) {
+		t.Run(name, func(t *testing.T) {
+			for _, email := range []string{"walt@example.com", "jesse@example.com", "skyler@example.com"} {
+				user, err := db.CreateUser(email, "hash")
+				if err != nil {
+					t.Fatal(err)
+				}
+				_, err = db.CreateChirp("hello from "+email, strconv.Itoa(user.Id))
+				if err != nil {
+					t.Fatal(err)
+				}
+			}
+
+			err := db.BlockUser(1, 1)
+			if !errors.Is(err, ErrSelfBlock) {
+				t.Fatalf("blocking oneself: got %v, want ErrSelfBlock", err)
+			}
+			err = db.BlockUser(1, 42)
+			if !errors.Is(err, ErrNotFound) {
+				t.Fatalf("blocking a missing user: got %v, want ErrNotFound", err)
+			}
+			err = db.FollowUser(2, 1)
+			if err != nil {
+				t.Fatal(err)
+			}
+			for i := 0; i < 2; i++ {
+				err = db.BlockUser(1, 2)
+				if err != nil {
+					t.Fatal(err)
+				}
+			}
+			following, err := db.GetFollowing(2)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(following) != 0 {
+				t.Fatalf("got %+v followed by user 2, want the block to have ended the follow", following)
+			}
+
+			err = db.FollowUser(2, 1)
+			if !errors.Is(err, ErrBlocked) {
+				t.Fatalf("following the blocker: got %v, want ErrBlocked", err)
+			}
+			_, err = db.LikeChirp(2, 1)
+			if !errors.Is(err, ErrBlocked) {
+				t.Fatalf("liking a chirp of the blocker: got %v, want ErrBlocked", err)
+			}
+			_, err = db.PostChirp(Chirp{Body: "no", AuthorId: 2, InReplyTo: 1})
+			if !errors.Is(err, ErrBlocked) {
+				t.Fatalf("replying to the blocker: got %v, want ErrBlocked", err)
+			}
+			_, err = db.PostChirp(Chirp{Body: "hi @walt@example.com", AuthorId: 2})
+			if !errors.Is(err, ErrBlocked) {
+				t.Fatalf("mentioning the blocker: got %v, want ErrBlocked", err)
+			}
+			_, err = db.EditChirp(2, 2, "hi @walt@example.com")
+			if !errors.Is(err, ErrBlocked) {
+				t.Fatalf("editing in a mention of the blocker: got %v, want ErrBlocked", err)
+			}
+
+			// The blocker isn't held back, nor is anyone else.
+			_, err = db.LikeChirp(1, 2)
+			if err != nil {
+				t.Fatal(err)
+			}
+			_, err = db.PostChirp(Chirp{Body: "hi @walt@example.com", AuthorId: 3, InReplyTo: 1})
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			for i := 0; i < 2; i++ {
+				err = db.UnblockUser(1, 2)
+				if err != nil {
+					t.Fatal(err)
+				}
+			}
+			_, err = db.PostChirp(Chirp{Body: "thanks @walt@example.com", AuthorId: 2, InReplyTo: 1})
+			if err != nil {
+				t.Fatal(err)
+			}
+			err = db.FollowUser(2, 1)
+			if err != nil {
+				t.Fatal(err)
+			}
+		})
+	}
+}
+
+func TestMutes(t *testing.T) {
+	for name, db := range openStores(t) {
+		t.Run(name, func(t *testing.T) {
+			for _, email := range []string{"walt@example.com", "jesse@example.com", "skyler@example.com"} {
+				user, err := db.CreateUser(email, "hash")
+				if err != nil {
+					t.Fatal(err)
+				}
+				_, err = db.CreateChirp("hello from "+email, strconv.Itoa(user.Id))
+				if err != nil {
+					t.Fatal(err)
+				}
+			}
+
+			err := db.MuteUser(1, 1)
+			if !errors.Is(err, ErrSelfBlock) {
+				t.Fatalf("muting oneself: got %v, want ErrSelfBlock", err)
+			}
+			err = db.MuteUser(1, 42)
+			if !errors.Is(err, ErrNotFound) {
+				t.Fatalf("muting a missing user: got %v, want ErrNotFound", err)
+			}
+			for _, followeeId := range []int{2, 3} {
+				err = db.FollowUser(1, followeeId)
+				if err != nil {
+					t.Fatal(err)
+				}
+			}
+			for i := 0; i < 2; i++ {
+				err = db.MuteUser(1, 2)
+				if err != nil {
+					t.Fatal(err)
+				}
+			}
+
+			chirps, err := db.QueryChirps(ChirpQuery{MutedBy: 1})
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(chirps) != 2 || chirps[0].Id != 1 || chirps[1].Id != 3 {
+				t.Fatalf("got %+v, want chirps 1 and 3", chirps)
+			}
+			chirps, err = db.QueryChirps(ChirpQuery{MutedBy: 3})
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(chirps) != 3 {
+				t.Fatalf("got %+v, want the mute not to touch other users", chirps)
+			}
+			timeline, err := db.GetTimeline(1, ChirpQuery{})
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(timeline) != 2 || timeline[0].Id != 1 || timeline[1].Id != 3 {
+				t.Fatalf("got timeline %+v, want chirps 1 and 3", timeline)
+			}
+
+			// Muted users can still follow and like.
+			err = db.FollowUser(2, 1)
+			if err != nil {
+				t.Fatal(err)
+			}
+			_, err = db.LikeChirp(2, 1)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			for i := 0; i < 2; i++ {
+				err = db.UnmuteUser(1, 2)
+				if err != nil {
+					t.Fatal(err)
+				}
+			}
+			timeline, err = db.GetTimeline(1, ChirpQuery{})
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(timeline) != 3 {
+				t.Fatalf("got timeline %+v, want all three chirps back", timeline)
+			}
+		})
+	}
+}
@@ -3,79 +3,333 @@ package database
 import (
 	"encoding/json"
 	"errors"
-	"fmt"
 	"log"
 	"os"
 	"sort"
-	"strconv"
-	"strings"
 	"sync"
 	"time"
-
-	"golang.org/x/crypto/bcrypt"
 )
 
+// Chirp and User timestamps are in UTC. Records from before schema
+// version 5 have zero timestamps since nobody knows when they were made.
+//
+// A rechirp reshares the chirp RefChirpId points at, with RefKind
+// telling a plain rechirp, which has no body, from a quote.
+//
+// A deleted chirp that still has replies or quotes is kept as a
+// tombstone: Deleted is set and only its place in the thread is left.
+// Tombstones only show up in threads and quotes, every other read
+// skips them.
+//
+// A chirp a moderator hid has Hidden set. Reads skip it just like a
+// tombstone, and threads and quotes show it as one.
 type Chirp struct {
-	Id       int    `json:"id"`
-	Body     string `json:"body"`
-	AuthorId int    `json:"author_id"`
+	Id         int       `json:"id"`
+	Uid        string    `json:"uid,omitempty"`
+	Body       string    `json:"body"`
+	AuthorId   int       `json:"author_id"`
+	InReplyTo  int       `json:"in_reply_to,omitempty"`
+	RefChirpId int       `json:"ref_chirp_id,omitempty"`
+	RefKind    string    `json:"ref_kind,omitempty"`
+	Visibility string    `json:"visibility,omitempty"`
+	Entities   Entities  `json:"entities,omitempty"`
+	Deleted    bool      `json:"deleted,omitempty"`
+	Hidden     bool      `json:"hidden,omitempty"`
+	CreatedAt  time.Time `json:"created_at"`
+	UpdatedAt  time.Time `json:"updated_at"`
+}
+
+// listed reports whether chirp shows up anywhere but in threads and quotes
+func (chirp Chirp) listed() bool {
+	return !chirp.Deleted && !chirp.Hidden
+}
+
+// placeholder returns what threads and quotes show of chirp,
+// which is only its place in them for a hidden chirp
+func (chirp Chirp) placeholder() Chirp {
+	if !chirp.Hidden {
+		return chirp
+	}
+	return Chirp{
+		Id:         chirp.Id,
+		InReplyTo:  chirp.InReplyTo,
+		RefChirpId: chirp.RefChirpId,
+		RefKind:    chirp.RefKind,
+		Hidden:     true,
+		CreatedAt:  chirp.CreatedAt,
+		UpdatedAt:  chirp.UpdatedAt,
+	}
+}
+
+// Kinds of RefChirpId
+const (
+	RefRechirp = "rechirp"
+	RefQuote   = "quote"
+)
+
+// ChirpVersion is a body a chirp had, CreatedAt being when it was written.
+// Versions are numbered from 1, the oldest, in the order they were written.
+type ChirpVersion struct {
+	ChirpId   int       `json:"chirp_id"`
+	Version   int       `json:"version"`
+	Body      string    `json:"body"`
+	CreatedAt time.Time `json:"created_at"`
 }
 
 type User struct {
-	Id          int    `json:"id"`
-	Email       string `json:"email"`
-	Password    string `json:"password"`
-	IsChirpyRed bool   `json:"is_chirpy_red"`
+	Id          int       `json:"id"`
+	Uid         string    `json:"uid,omitempty"`
+	Email       string    `json:"email"`
+	Password    string    `json:"password"`
+	IsChirpyRed bool      `json:"is_chirpy_red"`
+	CreatedAt   time.Time `json:"created_at"`
+	UpdatedAt   time.Time `json:"updated_at"`
 }
 
+// DB keeps the whole database in memory and writes it back to a
+// JSON file, either on every mutation or every flushInterval.
 type DB struct {
-	path string
-	mux  *sync.RWMutex
+	txStore
+	path          string
+	mux           *sync.RWMutex
+	journal       bool
+	idScheme      string
+	data          DBStructure
+	dirty         bool
+	flushInterval time.Duration
+	stop          chan struct{}
+	done          chan struct{}
 }
 
 type DBStructure struct {
-	Chirps map[int]Chirp        `json:"chirps"`
-	Users  map[int]User         `json:"users"`
-	Tokens map[string]time.Time `json:"tokens"`
+	Version int                     `json:"version"`
+	Chirps  map[int]Chirp           `json:"chirps"`
+	Users   map[int]User            `json:"users"`
+	Tokens  map[string]RevokedToken `json:"tokens"`
+	// Sequences holds the last id handed out per table,
+	// ids of deleted records are never reused
+	Sequences map[string]int `json:"sequences"`
+	// History holds the earlier versions of edited chirps
+	History map[int][]ChirpVersion `json:"history"`
+	// Likes holds when each user liked a chirp, by chirp and user id
+	Likes map[int]map[int]time.Time `json:"likes"`
+	// Follows holds when each user started following another,
+	// by follower and followee id
+	Follows map[int]map[int]time.Time `json:"follows"`
+	// BannedWords is the profanity list, by word
+	BannedWords map[string]BannedWord `json:"banned_words"`
+	// Reports holds the reports on chirps, by id
+	Reports map[int]Report `json:"reports"`
+	// Blocks holds when each user blocked another,
+	// by blocker and blocked id
+	Blocks map[int]map[int]time.Time `json:"blocks"`
+	// Mutes holds when each user muted another,
+	// by muter and muted id
+	Mutes map[int]map[int]time.Time `json:"mutes"`
+
+	// Secondary indexes, rebuilt on load and kept up
+	// to date by journalEntry.apply
+	chirpsByAuthor map[int]map[int]struct{}
+	chirpIdsByUid  map[string]int
+	repliesByChirp map[int]map[int]struct{}
+	refsByChirp    map[int]map[int]struct{}
+	chirpsByTag    map[string]map[int]struct{}
+	mentionsOf     map[int]map[int]struct{}
+	// searchIndex holds where each word is in each chirp that has
+	// it, searchDocs and searchTokens how many chirps and words it has
+	searchIndex    map[string]map[int][]int
+	searchDocs     int
+	searchTokens   int
+	userIdsByEmail map[string]int
+	likesByUser    map[int]map[int]struct{}
+	followersOf    map[int]map[int]struct{}
+}
+
+// RevokedToken records when a refresh token was revoked and when it
+// expires on its own, after which the revocation can be forgotten
+type RevokedToken struct {
+	RevokedAt time.Time `json:"revoked_at"`
+	ExpiresAt time.Time `json:"expires_at"`
 }
 
-// NewDB creates a new database connection
-// and creates the database file if it doesn't exist
+// legacyTokenLifetime is how long refresh tokens were issued for
+// before their expiry was recorded on revocation
+const legacyTokenLifetime = 1440 * time.Hour
+
+// UnmarshalJSON also accepts the bare revocation time
+// that schema versions before 2 stored
+func (revokedToken *RevokedToken) UnmarshalJSON(data []byte) error {
+	var revokedAt time.Time
+	if json.Unmarshal(data, &revokedAt) == nil {
+		*revokedToken = RevokedToken{RevokedAt: revokedAt}
+		return nil
+	}
+	type plain RevokedToken
+	return json.Unmarshal(data, (*plain)(revokedToken))
+}
+
+// NewDB creates a new database connection, creates the database
+// file if it doesn't exist and loads it into memory
 func NewDB(path string) (*DB, error) {
+	db, err := openDB(path)
+	if err != nil {
+		return &DB{}, err
+	}
+	err = checkVersion(path, db.data.Version)
+	if err != nil {
+		return &DB{}, err
+	}
+	return db, nil
+}
+
+// openDB does the work of NewDB without looking at the schema version
+func openDB(path string) (*DB, error) {
 	mux := sync.RWMutex{}
 	db := DB{path: path, mux: &mux}
+	db.txStore = txStore{backend: &db}
 	err := db.ensureDB()
 	if err != nil {
 		return &DB{}, err
 	}
+	db.data, err = db.readDB()
+	if err != nil {
+		return &DB{}, err
+	}
+	// Recover whatever a crash left in the journal, even if
+	// journaling has since been turned off.
+	err = db.replayJournal()
+	if err != nil {
+		return &DB{}, err
+	}
 	return &db, nil
 }
 
+// startFlusher switches the DB to write-behind: mutations only mark
+// the data dirty and a goroutine writes it out every interval
+func (db *DB) startFlusher(interval time.Duration) {
+	db.flushInterval = interval
+	db.stop = make(chan struct{})
+	db.done = make(chan struct{})
+	go func() {
+		defer close(db.done)
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ticker.C:
+				db.mux.Lock()
+				err := db.flush()
+				db.mux.Unlock()
+				if err != nil {
+					log.Printf("Error flushing %s: %s", db.path, err)
+				}
+			case <-db.stop:
+				return
+			}
+		}
+	}()
+}
+
+// Close stops the background flusher, if any,
+// and writes out anything not yet on disk
+func (db *DB) Close() error {
+	if db.stop != nil {
+		close(db.stop)
+		<-db.done
+		db.stop = nil
+	}
+	db.mux.Lock()
+	defer db.mux.Unlock()
+	return db.flush()
+}
+
 // ensureDB creates a new database file if it doesn't exist
 func (db *DB) ensureDB() error {
 	_, err := os.Stat(db.path)
 	// I don't really like this bit of code frankly
 	if errors.Is(err, os.ErrNotExist) {
-		file, err := os.Create(db.path)
-		if err != nil {
-			return err
-		}
-		defer file.Close()
-		_, err = file.Write([]byte("{}"))
-		if err != nil {
-			return err
-		}
-		return nil
+		return writeFileAtomic(db.path, []byte("{}"), 0666)
 	} else if err != nil {
 		return err
 	}
 	return nil
 }
 
-// loadDB reads the database file into memory
+// LoadDB returns a copy of the in-memory database
 func (db *DB) LoadDB() (DBStructure, error) {
 	db.mux.RLock()
 	defer db.mux.RUnlock()
+	return db.data.copy(), nil
+}
+
+// copy returns a DBStructure that shares no maps with dbStructure
+func (dbStructure DBStructure) copy() DBStructure {
+	dbCopy := DBStructure{
+		Version:   dbStructure.Version,
+		Chirps:    make(map[int]Chirp, len(dbStructure.Chirps)),
+		Users:     make(map[int]User, len(dbStructure.Users)),
+		Tokens:    make(map[string]RevokedToken, len(dbStructure.Tokens)),
+		Sequences: make(map[string]int, len(dbStructure.Sequences)),
+		History:   make(map[int][]ChirpVersion, len(dbStructure.History)),
+		Likes:     make(map[int]map[int]time.Time, len(dbStructure.Likes)),
+		Follows:   make(map[int]map[int]time.Time, len(dbStructure.Follows)),
+
+		BannedWords: make(map[string]BannedWord, len(dbStructure.BannedWords)),
+		Reports:     make(map[int]Report, len(dbStructure.Reports)),
+		Blocks:      make(map[int]map[int]time.Time, len(dbStructure.Blocks)),
+		Mutes:       make(map[int]map[int]time.Time, len(dbStructure.Mutes)),
+	}
+	for id, chirp := range dbStructure.Chirps {
+		dbCopy.Chirps[id] = chirp
+	}
+	for id, user := range dbStructure.Users {
+		dbCopy.Users[id] = user
+	}
+	for token, revokedToken := range dbStructure.Tokens {
+		dbCopy.Tokens[token] = revokedToken
+	}
+	for table, last := range dbStructure.Sequences {
+		dbCopy.Sequences[table] = last
+	}
+	for chirpId, versions := range dbStructure.History {
+		dbCopy.History[chirpId] = append([]ChirpVersion(nil), versions...)
+	}
+	for chirpId, likes := range dbStructure.Likes {
+		dbCopy.Likes[chirpId] = make(map[int]time.Time, len(likes))
+		for userId, likedAt := range likes {
+			dbCopy.Likes[chirpId][userId] = likedAt
+		}
+	}
+	for followerId, follows := range dbStructure.Follows {
+		dbCopy.Follows[followerId] = make(map[int]time.Time, len(follows))
+		for followeeId, followedAt := range follows {
+			dbCopy.Follows[followerId][followeeId] = followedAt
+		}
+	}
+	for word, bannedWord := range dbStructure.BannedWords {
+		dbCopy.BannedWords[word] = bannedWord
+	}
+	for id, report := range dbStructure.Reports {
+		dbCopy.Reports[id] = report
+	}
+	for blockerId, blocks := range dbStructure.Blocks {
+		dbCopy.Blocks[blockerId] = make(map[int]time.Time, len(blocks))
+		for blockedId, blockedAt := range blocks {
+			dbCopy.Blocks[blockerId][blockedId] = blockedAt
+		}
+	}
+	for muterId, mutes := range dbStructure.Mutes {
+		dbCopy.Mutes[muterId] = make(map[int]time.Time, len(mutes))
+		for mutedId, mutedAt := range mutes {
+			dbCopy.Mutes[muterId][mutedId] = mutedAt
+		}
+	}
+	dbCopy.buildIndexes()
+	return dbCopy
+}
+
+// readDB reads the database file from disk
+func (db *DB) readDB() (DBStructure, error) {
 	databaseBytes, err := os.ReadFile(db.path)
 	if err != nil {
 		return DBStructure{}, err
@@ -83,7 +337,13 @@ func (db *DB) LoadDB() (DBStructure, error) {
 	if jsonInfo, err := os.Stat(db.path); err != nil {
 		return DBStructure{}, err
 	} else if jsonInfo.Size() <= 2 {
-		return DBStructure{make(map[int]Chirp), make(map[int]User), make(map[string]time.Time)}, nil
+		dbStructure := DBStructure{Version: SchemaVersion()}
+		dbStructure.initMaps()
+		for _, bannedWord := range seedBannedWords(time.Now().UTC()) {
+			dbStructure.BannedWords[bannedWord.Word] = bannedWord
+		}
+		dbStructure.buildIndexes()
+		return dbStructure, nil
 	}
 	var dbStructure DBStructure
 	err = json.Unmarshal(databaseBytes, &dbStructure)
@@ -91,246 +351,640 @@ func (db *DB) LoadDB() (DBStructure, error) {
 		log.Printf("Error unmarshalling JSON: %s", err)
 		return DBStructure{}, err
 	}
+	dbStructure.initMaps()
+	dbStructure.buildIndexes()
 	return dbStructure, nil
 }
 
-// writeDB writes the database file to disk
+// initMaps makes any tables missing from the file usable
+func (dbStructure *DBStructure) initMaps() {
+	if dbStructure.Chirps == nil {
+		dbStructure.Chirps = make(map[int]Chirp)
+	}
+	if dbStructure.Users == nil {
+		dbStructure.Users = make(map[int]User)
+	}
+	if dbStructure.Tokens == nil {
+		dbStructure.Tokens = make(map[string]RevokedToken)
+	}
+	if dbStructure.Sequences == nil {
+		dbStructure.Sequences = make(map[string]int)
+	}
+	if dbStructure.History == nil {
+		dbStructure.History = make(map[int][]ChirpVersion)
+	}
+	if dbStructure.Likes == nil {
+		dbStructure.Likes = make(map[int]map[int]time.Time)
+	}
+	if dbStructure.Follows == nil {
+		dbStructure.Follows = make(map[int]map[int]time.Time)
+	}
+	if dbStructure.BannedWords == nil {
+		dbStructure.BannedWords = make(map[string]BannedWord)
+	}
+	if dbStructure.Reports == nil {
+		dbStructure.Reports = make(map[int]Report)
+	}
+	if dbStructure.Blocks == nil {
+		dbStructure.Blocks = make(map[int]map[int]time.Time)
+	}
+	if dbStructure.Mutes == nil {
+		dbStructure.Mutes = make(map[int]map[int]time.Time)
+	}
+}
+
+// writeDB writes the database file to disk, the caller must hold db.mux
 func (db *DB) writeDB(dbStructure DBStructure) error {
-	db.mux.Lock()
-	defer db.mux.Unlock()
 	dbStructureBytes, err := json.MarshalIndent(dbStructure, "", "  ")
 	if err != nil {
 		return err
 	}
-	err = os.WriteFile(db.path, dbStructureBytes, 0666)
+	err = writeFileAtomic(db.path, dbStructureBytes, 0666)
 	if err != nil {
 		return err
 	}
 	return nil
 }
 
-// GetChirps returns all chirps in the database
-func (db *DB) GetChirps() ([]Chirp, error) {
-	dbStructure, err := db.LoadDB()
-	if err != nil {
-		return []Chirp{}, err
+// commit persists entries that were already applied to the in-memory
+// data. With journaling on, the entries are synced to the journal
+// before the caller releases db.mux, so they survive a crash before the
+// snapshot is written. Once they are in the journal they are committed:
+// they would be replayed on the next start anyway, so a failed snapshot
+// write is left for the next flush to retry. An error means the entries
+// reached neither the journal nor the file. The caller must hold db.mux
+// for writing.
+func (db *DB) commit(entries []journalEntry) error {
+	if db.journal {
+		err := db.appendJournal(entries)
+		if err != nil {
+			return err
+		}
 	}
-	chirps := make([]Chirp, len(dbStructure.Chirps))
-	index := 0
-	for _, chirp := range dbStructure.Chirps {
-		chirps[index] = chirp
-		index++
+	db.dirty = true
+	if db.flushInterval > 0 {
+		return nil
 	}
-	sort.Slice(chirps, func(i, j int) bool {
-		return chirps[i].Id < chirps[j].Id
-	})
-	return chirps, nil
+	err := db.flush()
+	if err != nil && db.journal {
+		log.Printf("Writing %s failed, its changes are kept in the journal: %s", db.path, err)
+		return nil
+	}
+	return err
 }
 
-func (db *DB) DeleteChirp(chirpId string) error {
-	chirpIdInt, err := strconv.Atoi(chirpId)
-	if err != nil {
-		return err
+// flush writes the in-memory data to disk if it changed since the
+// last write, the caller must hold db.mux for writing
+func (db *DB) flush() error {
+	if !db.dirty {
+		return nil
 	}
-	dbStructure, err := db.LoadDB()
+	err := db.writeDB(db.data)
 	if err != nil {
 		return err
 	}
-	delete(dbStructure.Chirps, chirpIdInt)
-	err = db.writeDB(dbStructure)
-	if err != nil {
-		return err
+	db.dirty = false
+	if db.journal {
+		return db.truncateJournal()
 	}
 	return nil
 }
 
-// Add functionality to see if the chirp exists so it doesn't give Forbidden when
-// it just does not exist
-func (db *DB) ChirpBelongsToUser(chirpId string, authorId string) error {
-	chirpIdInt, err := strconv.Atoi(chirpId)
+// View runs fn against the in-memory data, holding off writers until it returns
+func (db *DB) View(fn func(tx Tx) error) error {
+	db.mux.RLock()
+	defer db.mux.RUnlock()
+	return fn(&jsonTx{db: db})
+}
+
+// Update runs fn with exclusive access to the data. Its changes are
+// applied as fn makes them, undone if fn fails and committed if not.
+func (db *DB) Update(fn func(tx Tx) error) error {
+	db.mux.Lock()
+	defer db.mux.Unlock()
+	tx := &jsonTx{db: db, writable: true}
+	err := fn(tx)
 	if err != nil {
+		tx.rollback()
 		return err
 	}
-	authorIdInt, err := strconv.Atoi(authorId)
+	if len(tx.entries) == 0 {
+		return nil
+	}
+	err = db.commit(tx.entries)
 	if err != nil {
+		// Nothing reached the journal or the file, forget it all.
+		// The failed write leaves the data dirty, so the next flush
+		// rewrites the file even if nothing else changes.
+		tx.rollback()
 		return err
 	}
-	dbStructure, err := db.LoadDB()
+	return nil
+}
+
+// jsonTx works directly on the DB's in-memory data while its lock is held
+type jsonTx struct {
+	db       *DB
+	writable bool
+	entries  []journalEntry
+	undo     []func()
+}
+
+// apply makes a change, remembering it for the journal and how to revert it
+func (tx *jsonTx) apply(entry journalEntry) error {
+	if !tx.writable {
+		return errReadOnly
+	}
+	undo := tx.db.data.undoFor(entry)
+	err := entry.apply(&tx.db.data)
 	if err != nil {
 		return err
 	}
-	chirp, ok := dbStructure.Chirps[chirpIdInt]
-	if !ok {
-		return errors.New("Not found!")
+	tx.entries = append(tx.entries, entry)
+	tx.undo = append(tx.undo, undo)
+	return nil
+}
+
+// rollback reverts every change made through tx, newest first
+func (tx *jsonTx) rollback() {
+	for i := len(tx.undo) - 1; i >= 0; i-- {
+		tx.undo[i]()
 	}
-	if chirp.AuthorId != authorIdInt {
-		return errors.New("Forbidden!")
+	tx.entries = nil
+	tx.undo = nil
+}
+
+func (tx *jsonTx) GetChirps() ([]Chirp, error) {
+	dbStructure := tx.db.data
+	chirps := make([]Chirp, 0, len(dbStructure.Chirps))
+	for _, chirp := range dbStructure.Chirps {
+		if chirp.listed() {
+			chirps = append(chirps, chirp)
+		}
 	}
-	return nil
+	sort.Slice(chirps, func(i, j int) bool {
+		return chirps[i].Id < chirps[j].Id
+	})
+	return chirps, nil
 }
 
-// CreateChirp creates a new chirp and saves it to disk
-// Assume ID's are in order
-func (db *DB) CreateChirp(body string, authorId string) (Chirp, error) {
-	authorIdInt, err := strconv.Atoi(authorId)
+func (tx *jsonTx) GetChirp(id int) (Chirp, error) {
+	chirp, err := tx.GetThreadChirp(id)
 	if err != nil {
 		return Chirp{}, err
 	}
-	dbStructure, err := db.LoadDB()
-	if err != nil {
-		return Chirp{}, err
+	if !chirp.listed() {
+		return Chirp{}, ErrNotFound
 	}
-	var newChirpId int
-	if len(dbStructure.Chirps) < 1 {
-		newChirpId = 1
+	return chirp, nil
+}
+
+func (tx *jsonTx) GetThreadChirp(id int) (Chirp, error) {
+	chirp, ok := tx.db.data.Chirps[id]
+	if !ok {
+		return Chirp{}, ErrNotFound
+	}
+	return chirp, nil
+}
+
+func (tx *jsonTx) GetReplies(chirpId int) ([]Chirp, error) {
+	return tx.chirpsIn(tx.db.data.repliesByChirp[chirpId]), nil
+}
+
+func (tx *jsonTx) GetRechirps(chirpId int) ([]Chirp, error) {
+	return tx.chirpsIn(tx.db.data.refsByChirp[chirpId]), nil
+}
+
+// chirpsIn returns the chirps with the given ids, oldest first
+func (tx *jsonTx) chirpsIn(chirpIds map[int]struct{}) []Chirp {
+	chirps := make([]Chirp, 0, len(chirpIds))
+	for chirpId := range chirpIds {
+		chirps = append(chirps, tx.db.data.Chirps[chirpId])
+	}
+	sort.Slice(chirps, func(i, j int) bool {
+		return ChirpQuery{}.before(chirps[i], chirps[j])
+	})
+	return chirps
+}
+
+func (tx *jsonTx) GetChirpByUid(uid string) (Chirp, error) {
+	dbStructure := tx.db.data
+	chirpId, ok := dbStructure.chirpIdsByUid[uid]
+	if !ok {
+		return Chirp{}, ErrNotFound
+	}
+	return dbStructure.Chirps[chirpId], nil
+}
+
+func (tx *jsonTx) GetChirpsByAuthor(authorId int) ([]Chirp, error) {
+	dbStructure := tx.db.data
+	chirpIds := dbStructure.chirpsByAuthor[authorId]
+	chirps := make([]Chirp, 0, len(chirpIds))
+	for chirpId := range chirpIds {
+		chirps = append(chirps, dbStructure.Chirps[chirpId])
+	}
+	sort.Slice(chirps, func(i, j int) bool {
+		return chirps[i].Id < chirps[j].Id
+	})
+	return chirps, nil
+}
+
+func (tx *jsonTx) QueryChirps(query ChirpQuery) ([]Chirp, error) {
+	dbStructure := tx.db.data
+	chirps := []Chirp{}
+	muted := dbStructure.Mutes[query.MutedBy]
+	var candidates []Chirp
+	keep := func(chirp Chirp) {
+		if _, ok := muted[chirp.AuthorId]; ok {
+			return
+		}
+		if query.matches(chirp) {
+			candidates = append(candidates, chirp)
+		}
+	}
+	if query.AuthorId != 0 {
+		for chirpId := range dbStructure.chirpsByAuthor[query.AuthorId] {
+			keep(dbStructure.Chirps[chirpId])
+		}
+	} else if query.Hashtag != "" {
+		for chirpId := range dbStructure.chirpsByTag[normalizeHashtag(query.Hashtag)] {
+			keep(dbStructure.Chirps[chirpId])
+		}
+	} else if query.MentionOf != 0 {
+		for chirpId := range dbStructure.mentionsOf[query.MentionOf] {
+			keep(dbStructure.Chirps[chirpId])
+		}
+	} else if query.AuthorIds != nil {
+		seen := make(map[int]struct{}, len(query.AuthorIds))
+		for _, authorId := range query.AuthorIds {
+			if _, ok := seen[authorId]; ok {
+				continue
+			}
+			seen[authorId] = struct{}{}
+			for chirpId := range dbStructure.chirpsByAuthor[authorId] {
+				keep(dbStructure.Chirps[chirpId])
+			}
+		}
 	} else {
-		chirps := make([]Chirp, len(dbStructure.Chirps))
-		index := 0
 		for _, chirp := range dbStructure.Chirps {
-			chirps[index] = chirp
-			index++
+			keep(chirp)
+		}
+	}
+	// Visibility is left to canSee so its rules live in one place.
+	for _, chirp := range candidates {
+		ok, err := canSee(tx, chirp, query.ViewerId)
+		if err != nil {
+			return []Chirp{}, err
 		}
-		sort.Slice(chirps, func(i, j int) bool {
-			return chirps[i].Id < chirps[j].Id
-		})
-		newChirpId = chirps[len(chirps)-1].Id + 1
-	}
-	newChirp := Chirp{
-		Id:       newChirpId,
-		Body:     body,
-		AuthorId: authorIdInt,
-	}
-	dbStructure.Chirps[newChirp.Id] = newChirp
-	err = db.writeDB(dbStructure)
+		if ok {
+			chirps = append(chirps, chirp)
+		}
+	}
+	sort.Slice(chirps, func(i, j int) bool {
+		return query.before(chirps[i], chirps[j])
+	})
+	if query.Limit > 0 && len(chirps) > query.Limit {
+		chirps = chirps[:query.Limit]
+	}
+	return chirps, nil
+}
+
+func (tx *jsonTx) InsertChirp(chirp Chirp) (Chirp, error) {
+	uid, err := newUid(tx.db.idScheme)
+	if err != nil {
+		return Chirp{}, err
+	}
+	chirp.Id = tx.db.data.Sequences[sequenceChirps] + 1
+	chirp.Uid = uid
+	err = tx.apply(putChirpEntry(chirp))
 	if err != nil {
 		return Chirp{}, err
 	}
-	return newChirp, nil
+	return chirp, nil
 }
 
-// Nearly identical to CreateChirp
-func (db *DB) CreateUser(email string, password string) (User, error) {
-	dbStructure, err := db.LoadDB()
-	if err != nil {
-		return User{}, err
+func (tx *jsonTx) PutChirp(chirp Chirp) error {
+	return tx.apply(putChirpEntry(chirp))
+}
+
+func (tx *jsonTx) DeleteChirp(id int) error {
+	return tx.apply(deleteChirpEntry(id))
+}
+
+func (tx *jsonTx) GetChirpVersions(chirpId int) ([]ChirpVersion, error) {
+	versions := tx.db.data.History[chirpId]
+	return append([]ChirpVersion{}, versions...), nil
+}
+
+func (tx *jsonTx) AddChirpVersion(version ChirpVersion) error {
+	return tx.apply(addChirpVersionEntry(version))
+}
+
+func (tx *jsonTx) PutChirpVersion(version ChirpVersion) error {
+	return tx.apply(putChirpVersionEntry(version))
+}
+
+func (tx *jsonTx) GetLike(userId int, chirpId int) (Like, error) {
+	likedAt, ok := tx.db.data.Likes[chirpId][userId]
+	if !ok {
+		return Like{}, ErrNotFound
 	}
-	var newUserId int
-	if len(dbStructure.Users) < 1 {
-		newUserId = 1
-	} else {
-		// Breaks if you delete a user btw.
-		// lastUser := dbStructure.Users[len(dbStructure.Users)]
-		// newUserId = lastUser.Id + 1
-		users := make([]User, len(dbStructure.Users))
-		index := 0
-		for _, user := range dbStructure.Users {
-			users[index] = user
-			index++
+	return Like{UserId: userId, ChirpId: chirpId, CreatedAt: likedAt}, nil
+}
+
+func (tx *jsonTx) GetLikesByUser(userId int) ([]Like, error) {
+	dbStructure := tx.db.data
+	chirpIds := dbStructure.likesByUser[userId]
+	likes := make([]Like, 0, len(chirpIds))
+	for chirpId := range chirpIds {
+		likes = append(likes, Like{UserId: userId, ChirpId: chirpId, CreatedAt: dbStructure.Likes[chirpId][userId]})
+	}
+	sort.Slice(likes, func(i, j int) bool {
+		if !likes[i].CreatedAt.Equal(likes[j].CreatedAt) {
+			return likes[i].CreatedAt.After(likes[j].CreatedAt)
 		}
-		sort.Slice(users, func(i, j int) bool {
-			return users[i].Id < users[j].Id
-		})
-		newUserId = users[len(users)-1].Id + 1
-	}
-	// Can this be done better?
-	for _, user := range dbStructure.Users {
-		if strings.ToLower(user.Email) == strings.ToLower(email) {
-			return User{}, errors.New("Email already exists!")
+		return likes[i].ChirpId > likes[j].ChirpId
+	})
+	return likes, nil
+}
+
+func (tx *jsonTx) CountLikes(chirpIds []int) (map[int]int, error) {
+	counts := make(map[int]int, len(chirpIds))
+	for _, chirpId := range chirpIds {
+		if tx.db.data.Chirps[chirpId].listed() {
+			counts[chirpId] = len(tx.db.data.Likes[chirpId])
 		}
 	}
-	newUser := User{
-		Id:          newUserId,
-		Email:       email,
-		Password:    password,
-		IsChirpyRed: false,
-	}
-	dbStructure.Users[newUser.Id] = newUser
-	err = db.writeDB(dbStructure)
-	if err != nil {
-		return User{}, err
+	return counts, nil
+}
+
+func (tx *jsonTx) PutLike(like Like) error {
+	return tx.apply(putLikeEntry(like))
+}
+
+func (tx *jsonTx) DeleteLike(userId int, chirpId int) error {
+	return tx.apply(deleteLikeEntry(Like{UserId: userId, ChirpId: chirpId}))
+}
+
+func (tx *jsonTx) SearchTerm(term string) (map[int][]int, error) {
+	postings := make(map[int][]int, len(tx.db.data.searchIndex[term]))
+	for chirpId, positions := range tx.db.data.searchIndex[term] {
+		postings[chirpId] = positions
 	}
-	return newUser, nil
+	return postings, nil
 }
 
-func (db *DB) UpgradeUser(id int) (User, error) {
-	dbStructure, err := db.LoadDB()
-	if err != nil {
-		return User{}, err
+func (tx *jsonTx) SearchStats() (int, int, error) {
+	return tx.db.data.searchDocs, tx.db.data.searchTokens, nil
+}
+
+// RebuildSearchIndex rebuilds all the secondary indexes, the search
+// index of the JSON store is never written out but built on load
+func (tx *jsonTx) RebuildSearchIndex() (int, error) {
+	if !tx.writable {
+		return 0, errReadOnly
+	}
+	tx.db.data.buildIndexes()
+	return tx.db.data.searchDocs, nil
+}
+
+func (tx *jsonTx) GetFollow(followerId int, followeeId int) (Follow, error) {
+	followedAt, ok := tx.db.data.Follows[followerId][followeeId]
+	if !ok {
+		return Follow{}, ErrNotFound
 	}
-	var modifiedUser User
-	var indexUser int
-	for index, user := range dbStructure.Users {
-		if user.Id == id {
-			modifiedUser = user
-			indexUser = index
-			break
+	return Follow{FollowerId: followerId, FolloweeId: followeeId, CreatedAt: followedAt}, nil
+}
+
+func (tx *jsonTx) GetFollowsBy(followerId int) ([]Follow, error) {
+	dbStructure := tx.db.data
+	follows := make([]Follow, 0, len(dbStructure.Follows[followerId]))
+	for followeeId, followedAt := range dbStructure.Follows[followerId] {
+		follows = append(follows, Follow{FollowerId: followerId, FolloweeId: followeeId, CreatedAt: followedAt})
+	}
+	sortFollows(follows)
+	return follows, nil
+}
+
+func (tx *jsonTx) GetFollowsOf(followeeId int) ([]Follow, error) {
+	dbStructure := tx.db.data
+	follows := make([]Follow, 0, len(dbStructure.followersOf[followeeId]))
+	for followerId := range dbStructure.followersOf[followeeId] {
+		follows = append(follows, Follow{FollowerId: followerId, FolloweeId: followeeId, CreatedAt: dbStructure.Follows[followerId][followeeId]})
+	}
+	sortFollows(follows)
+	return follows, nil
+}
+
+// sortFollows orders follows newest first, the way the SQLite store does
+func sortFollows(follows []Follow) {
+	sort.Slice(follows, func(i, j int) bool {
+		if !follows[i].CreatedAt.Equal(follows[j].CreatedAt) {
+			return follows[i].CreatedAt.After(follows[j].CreatedAt)
 		}
+		if follows[i].FollowerId != follows[j].FollowerId {
+			return follows[i].FollowerId > follows[j].FollowerId
+		}
+		return follows[i].FolloweeId > follows[j].FolloweeId
+	})
+}
+
+func (tx *jsonTx) PutFollow(follow Follow) error {
+	return tx.apply(putFollowEntry(follow))
+}
+
+func (tx *jsonTx) DeleteFollow(followerId int, followeeId int) error {
+	return tx.apply(deleteFollowEntry(Follow{FollowerId: followerId, FolloweeId: followeeId}))
+}
+
+func (tx *jsonTx) GetBlock(blockerId int, blockedId int) (Block, error) {
+	blockedAt, ok := tx.db.data.Blocks[blockerId][blockedId]
+	if !ok {
+		return Block{}, ErrNotFound
 	}
-	modifiedUser.IsChirpyRed = true
-	dbStructure.Users[indexUser] = modifiedUser
-	err = db.writeDB(dbStructure)
-	if err != nil {
-		return User{}, err
+	return Block{BlockerId: blockerId, BlockedId: blockedId, CreatedAt: blockedAt}, nil
+}
+
+func (tx *jsonTx) PutBlock(block Block) error {
+	return tx.apply(putBlockEntry(block))
+}
+
+func (tx *jsonTx) DeleteBlock(blockerId int, blockedId int) error {
+	return tx.apply(deleteBlockEntry(Block{BlockerId: blockerId, BlockedId: blockedId}))
+}
+
+func (tx *jsonTx) GetMute(muterId int, mutedId int) (Mute, error) {
+	mutedAt, ok := tx.db.data.Mutes[muterId][mutedId]
+	if !ok {
+		return Mute{}, ErrNotFound
+	}
+	return Mute{MuterId: muterId, MutedId: mutedId, CreatedAt: mutedAt}, nil
+}
+
+func (tx *jsonTx) PutMute(mute Mute) error {
+	return tx.apply(putMuteEntry(mute))
+}
+
+func (tx *jsonTx) DeleteMute(muterId int, mutedId int) error {
+	return tx.apply(deleteMuteEntry(Mute{MuterId: muterId, MutedId: mutedId}))
+}
+
+func (tx *jsonTx) GetBannedWords() ([]BannedWord, error) {
+	words := make([]BannedWord, 0, len(tx.db.data.BannedWords))
+	for _, bannedWord := range tx.db.data.BannedWords {
+		words = append(words, bannedWord)
 	}
-	return modifiedUser, nil
+	sortBannedWords(words)
+	return words, nil
 }
 
-func (db *DB) UpdateUser(id int, newEmail string, newPassword string) (User, error) {
-	dbStructure, err := db.LoadDB()
+func (tx *jsonTx) GetBannedWord(word string) (BannedWord, error) {
+	bannedWord, ok := tx.db.data.BannedWords[word]
+	if !ok {
+		return BannedWord{}, ErrNotFound
+	}
+	return bannedWord, nil
+}
+
+func (tx *jsonTx) PutBannedWord(word BannedWord) error {
+	return tx.apply(putBannedWordEntry(word))
+}
+
+func (tx *jsonTx) DeleteBannedWord(word string) error {
+	return tx.apply(deleteBannedWordEntry(word))
+}
+
+func (tx *jsonTx) InsertReport(report Report) (Report, error) {
+	report.Id = tx.db.data.Sequences[sequenceReports] + 1
+	err := tx.apply(putReportEntry(report))
 	if err != nil {
-		return User{}, err
+		return Report{}, err
 	}
-	var modifiedUser User
-	var indexUser int
-	for index, user := range dbStructure.Users {
-		if user.Id == id {
-			modifiedUser = user
-			indexUser = index
-			break
+	return report, nil
+}
+
+func (tx *jsonTx) PutReport(report Report) error {
+	return tx.apply(putReportEntry(report))
+}
+
+func (tx *jsonTx) GetReport(id int) (Report, error) {
+	report, ok := tx.db.data.Reports[id]
+	if !ok {
+		return Report{}, ErrNotFound
+	}
+	return report, nil
+}
+
+func (tx *jsonTx) GetReportsOf(chirpId int) ([]Report, error) {
+	return tx.reports(func(report Report) bool {
+		return report.ChirpId == chirpId
+	}), nil
+}
+
+func (tx *jsonTx) GetReportsBy(reporterId int) ([]Report, error) {
+	reports := tx.reports(func(report Report) bool {
+		return report.ReporterId == reporterId
+	})
+	for i, j := 0, len(reports)-1; i < j; i, j = i+1, j-1 {
+		reports[i], reports[j] = reports[j], reports[i]
+	}
+	return reports, nil
+}
+
+func (tx *jsonTx) GetReportsByStatus(status string) ([]Report, error) {
+	return tx.reports(func(report Report) bool {
+		return status == "" || report.Status == status
+	}), nil
+}
+
+// reports returns the reports keep selects, oldest first. There are
+// few enough reports to go through them all.
+func (tx *jsonTx) reports(keep func(report Report) bool) []Report {
+	reports := []Report{}
+	for _, report := range tx.db.data.Reports {
+		if keep(report) {
+			reports = append(reports, report)
 		}
 	}
+	sortReports(reports)
+	return reports
+}
+
+func (tx *jsonTx) GetUsers() ([]User, error) {
+	dbStructure := tx.db.data
+	users := make([]User, 0, len(dbStructure.Users))
 	for _, user := range dbStructure.Users {
-		if strings.ToLower(user.Email) == strings.ToLower(newEmail) {
-			return User{}, errors.New("Email already exists!")
-		}
+		users = append(users, user)
 	}
-	// A bit lazy which leads to extra computation.
-	hashedPassword, err := bcrypt.GenerateFromPassword([]byte(newPassword), 10)
+	sort.Slice(users, func(i, j int) bool {
+		return users[i].Id < users[j].Id
+	})
+	return users, nil
+}
+
+func (tx *jsonTx) GetUser(id int) (User, error) {
+	user, ok := tx.db.data.Users[id]
+	if !ok {
+		return User{}, ErrNotFound
+	}
+	return user, nil
+}
+
+func (tx *jsonTx) GetUserByEmail(email string) (User, error) {
+	dbStructure := tx.db.data
+	userId, ok := dbStructure.userIdsByEmail[normalizeEmail(email)]
+	if !ok {
+		return User{}, ErrNotFound
+	}
+	return dbStructure.Users[userId], nil
+}
+
+func (tx *jsonTx) InsertUser(user User) (User, error) {
+	uid, err := newUid(tx.db.idScheme)
 	if err != nil {
 		return User{}, err
 	}
-	modifiedUser.Password = fmt.Sprintf("%s", hashedPassword)
-	modifiedUser.Email = newEmail
-	dbStructure.Users[indexUser] = modifiedUser
-	err = db.writeDB(dbStructure)
+	user.Id = tx.db.data.Sequences[sequenceUsers] + 1
+	user.Uid = uid
+	err = tx.apply(putUserEntry(user))
 	if err != nil {
 		return User{}, err
 	}
-	return modifiedUser, nil
+	return user, nil
 }
 
-func (db *DB) RevokeToken(token string) error {
-	dbStructure, err := db.LoadDB()
-	if err != nil {
-		return err
-	}
-	dbStructure.Tokens[token] = time.Now()
-	err = db.writeDB(dbStructure)
-	if err != nil {
-		return err
+func (tx *jsonTx) PutUser(user User) error {
+	return tx.apply(putUserEntry(user))
+}
+
+func (tx *jsonTx) RevokeToken(token string, revokedToken RevokedToken) error {
+	return tx.apply(revokeTokenEntry(token, revokedToken))
+}
+
+func (tx *jsonTx) CheckRevocation(token string) error {
+	if _, ok := tx.db.data.Tokens[token]; ok {
+		return ErrRevoked
 	}
 	return nil
 }
 
-// Technically not okay since it will show Unauthorized
-// in case you fail to load the DB.
-func (db *DB) CheckRevocation(token string) error {
-	dbStructure, err := db.LoadDB()
-	if err != nil {
-		return err
+func (tx *jsonTx) PruneRevokedTokens(now time.Time) (int, error) {
+	pruned := 0
+	for _, revokedToken := range tx.db.data.Tokens {
+		if revokedToken.ExpiresAt.Before(now) {
+			pruned++
+		}
 	}
-	if _, ok := dbStructure.Tokens[token]; ok {
-		return errors.New("Token has been revoked!")
+	if pruned == 0 {
+		return 0, nil
 	}
-	return nil
+	err := tx.apply(pruneTokensEntry(now))
+	if err != nil {
+		return 0, err
+	}
+	return pruned, nil
+}
+
+func (tx *jsonTx) CountRevokedTokens() (int, error) {
+	return len(tx.db.data.Tokens), nil
 }
@@ -0,0 +1,129 @@
+package database
+
+import (
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+)
+
+// openStores returns one fresh store per backend
+func openStores(t *testing.T) map[string]Store {
+	t.Helper()
+	dir := t.TempDir()
+	jsonDB, err := Open(Config{Driver: "json", Path: filepath.Join(dir, "database.json")})
+	if err != nil {
+		t.Fatal(err)
+	}
+	sqliteDB, err := Open(Config{Driver: "sqlite", Path: filepath.Join(dir, "database.sqlite")})
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() {
+		jsonDB.Close()
+		sqliteDB.Close()
+	})
+	return map[string]Store{"json": jsonDB, "sqlite": sqliteDB}
+}
+
+func TestConcurrentCreateChirp(t *testing.T) {
+	const n = 300
+	for name, db := range openStores(t) {
+		t.Run(name, func(t *testing.T) {
+			var wg sync.WaitGroup
+			errs := make(chan error, n)
+			for i := 0; i < n; i++ {
+				wg.Add(1)
+				go func() {
+					defer wg.Done()
+					_, err := db.CreateChirp("hello", "1")
+					if err != nil {
+						errs <- err
+					}
+				}()
+			}
+			wg.Wait()
+			close(errs)
+			for err := range errs {
+				t.Fatal(err)
+			}
+			chirps, err := db.GetChirps()
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(chirps) != n {
+				t.Fatalf("got %d chirps, want %d", len(chirps), n)
+			}
+			seen := make(map[int]bool)
+			for _, chirp := range chirps {
+				if seen[chirp.Id] {
+					t.Fatalf("chirp id %d handed out twice", chirp.Id)
+				}
+				seen[chirp.Id] = true
+			}
+		})
+	}
+}
+
+func TestFlushIntervalWritesBehind(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "database.json")
+	db, err := Open(Config{Path: path, FlushInterval: time.Hour})
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = db.CreateChirp("hello", "1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := db.GetChirp(1); err != nil {
+		t.Fatalf("read after write not served from memory: %s", err)
+	}
+	onDisk, err := NewDB(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if chirps, _ := onDisk.GetChirps(); len(chirps) != 0 {
+		t.Fatalf("write reached the disk before the flush interval")
+	}
+	err = db.Close()
+	if err != nil {
+		t.Fatal(err)
+	}
+	onDisk, err = NewDB(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if chirps, _ := onDisk.GetChirps(); len(chirps) != 1 {
+		t.Fatalf("got %d chirps after Close, want 1", len(chirps))
+	}
+}
+
+func TestPruneRevokedTokens(t *testing.T) {
+	now := time.Now()
+	for name, db := range openStores(t) {
+		t.Run(name, func(t *testing.T) {
+			err := db.RevokeToken("expired", now.Add(-time.Minute))
+			if err != nil {
+				t.Fatal(err)
+			}
+			err = db.RevokeToken("still.valid", now.Add(time.Hour))
+			if err != nil {
+				t.Fatal(err)
+			}
+			pruned, err := db.PruneRevokedTokens(now)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if pruned != 1 {
+				t.Fatalf("pruned %d revocations, want 1", pruned)
+			}
+			count, err := db.CountRevokedTokens()
+			if err != nil || count != 1 {
+				t.Fatalf("%d revocations left, want 1 (%v)", count, err)
+			}
+			if db.CheckRevocation("still.valid") == nil {
+				t.Fatal("pruned a revocation that hasn't expired")
+			}
+		})
+	}
+}
@@ -0,0 +1,193 @@
+package database
+
+import (
+	"database/sql/driver"
+	"encoding/json"
+	"errors"
+	"strings"
+	"unicode"
+)
+
+// Kinds of Entity
+const (
+	EntityHashtag = "hashtag"
+	EntityMention = "mention"
+)
+
+// Entity is a #hashtag or an @mention in the body of a chirp. Start and
+// End are offsets in code points into the body, End being exclusive,
+// and span the # or @ too. Text is what follows the # as written.
+// Users are mentioned by email, as in @walt@example.com, but mentions
+// only keep the UserId they resolve to so entities never hand out
+// emails. Mentions of emails nobody has aren't entities.
+type Entity struct {
+	Kind   string `json:"kind"`
+	Text   string `json:"text,omitempty"`
+	Start  int    `json:"start"`
+	End    int    `json:"end"`
+	UserId int    `json:"user_id,omitempty"`
+}
+
+// Entities is stored as a JSON array in a single SQLite column
+type Entities []Entity
+
+func (entities Entities) Value() (driver.Value, error) {
+	if entities == nil {
+		entities = Entities{}
+	}
+	entitiesBytes, err := json.Marshal(entities)
+	if err != nil {
+		return nil, err
+	}
+	return string(entitiesBytes), nil
+}
+
+func (entities *Entities) Scan(src interface{}) error {
+	var entitiesBytes []byte
+	switch src := src.(type) {
+	case string:
+		entitiesBytes = []byte(src)
+	case []byte:
+		entitiesBytes = src
+	default:
+		return errors.New("Entities must be stored as JSON text!")
+	}
+	*entities = nil
+	err := json.Unmarshal(entitiesBytes, entities)
+	if err != nil {
+		return err
+	}
+	if len(*entities) == 0 {
+		*entities = nil
+	}
+	return nil
+}
+
+// normalizeHashtag is the form hashtags are compared and indexed in
+func normalizeHashtag(tag string) string {
+	return strings.ToLower(tag)
+}
+
+// hashtags returns the normalized hashtags of chirp, each once
+func (chirp Chirp) hashtags() []string {
+	var tags []string
+	for _, entity := range chirp.Entities {
+		if entity.Kind == EntityHashtag && !containsString(tags, normalizeHashtag(entity.Text)) {
+			tags = append(tags, normalizeHashtag(entity.Text))
+		}
+	}
+	return tags
+}
+
+// mentions returns the ids of the users chirp mentions, each once
+func (chirp Chirp) mentions() []int {
+	var userIds []int
+	for _, entity := range chirp.Entities {
+		if entity.Kind == EntityMention && !containsId(userIds, entity.UserId) {
+			userIds = append(userIds, entity.UserId)
+		}
+	}
+	return userIds
+}
+
+// withoutEmails returns entities with the emails mentions were
+// parsed from dropped, for entities found before they were
+func (entities Entities) withoutEmails() Entities {
+	for i, entity := range entities {
+		if entity.Kind == EntityMention {
+			entities[i].Text = ""
+		}
+	}
+	return entities
+}
+
+func containsString(values []string, value string) bool {
+	for _, candidate := range values {
+		if candidate == value {
+			return true
+		}
+	}
+	return false
+}
+
+// isWordRune reports whether r may be part of a hashtag
+func isWordRune(r rune) bool {
+	return unicode.IsLetter(r) || unicode.IsDigit(r) || unicode.IsMark(r) || r == '_'
+}
+
+// isEmailRune reports whether r may be part of a mentioned email
+func isEmailRune(r rune) bool {
+	return isWordRune(r) || strings.ContainsRune(".%+-@", r)
+}
+
+// parseEntities finds the hashtags and the would-be mentions in body,
+// the mentions are left for resolveEntities to tie to users. A # or @
+// only starts an entity at the start of a word.
+func parseEntities(body string) Entities {
+	runes := []rune(body)
+	var entities Entities
+	for i := 0; i < len(runes); i++ {
+		if runes[i] != '#' && runes[i] != '@' {
+			continue
+		}
+		if i > 0 && isEmailRune(runes[i-1]) {
+			continue
+		}
+		end := i + 1
+		if runes[i] == '#' {
+			hasLetter := false
+			for end < len(runes) && isWordRune(runes[end]) {
+				hasLetter = hasLetter || unicode.IsLetter(runes[end])
+				end++
+			}
+			if hasLetter {
+				entities = append(entities, Entity{Kind: EntityHashtag, Text: string(runes[i+1 : end]), Start: i, End: end})
+			}
+		} else {
+			for end < len(runes) && isEmailRune(runes[end]) {
+				end++
+			}
+			// Punctuation ending the sentence isn't part of the email.
+			for end > i+1 && strings.ContainsRune(".%+-@", runes[end-1]) {
+				end--
+			}
+			text := string(runes[i+1 : end])
+			local, domain, ok := strings.Cut(text, "@")
+			if ok && local != "" && domain != "" && !strings.Contains(domain, "@") {
+				entities = append(entities, Entity{Kind: EntityMention, Text: text, Start: i, End: end})
+			}
+		}
+		i = end - 1
+	}
+	return entities
+}
+
+// resolveEntities parses the entities of body, userIdByEmail tying
+// mentions to users in place of their email. Mentions of emails it
+// returns ErrNotFound for are dropped.
+func resolveEntities(body string, userIdByEmail func(email string) (int, error)) (Entities, error) {
+	var entities Entities
+	for _, entity := range parseEntities(body) {
+		if entity.Kind == EntityMention {
+			userId, err := userIdByEmail(entity.Text)
+			if errors.Is(err, ErrNotFound) {
+				continue
+			}
+			if err != nil {
+				return nil, err
+			}
+			entity.UserId = userId
+			entity.Text = ""
+		}
+		entities = append(entities, entity)
+	}
+	return entities, nil
+}
+
+// chirpEntities resolves the entities of body against the users of tx
+func chirpEntities(tx Tx, body string) (Entities, error) {
+	return resolveEntities(body, func(email string) (int, error) {
+		user, err := tx.GetUserByEmail(email)
+		return user.Id, err
+	})
+}
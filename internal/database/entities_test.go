@@ -0,0 +1,94 @@
+package database
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestParseEntities(t *testing.T) {
+	tests := []struct {
+		body string
+		want Entities
+	}{
+		{"no entities here", nil},
+		{"#golang is fun", Entities{{Kind: EntityHashtag, Text: "golang", Start: 0, End: 7}}},
+		{"crème #brûlée!", Entities{{Kind: EntityHashtag, Text: "brûlée", Start: 6, End: 13}}},
+		{"#1 and a#b aren't tags", nil},
+		{"#go_lang #Go2", Entities{
+			{Kind: EntityHashtag, Text: "go_lang", Start: 0, End: 8},
+			{Kind: EntityHashtag, Text: "Go2", Start: 9, End: 13},
+		}},
+		{"hi @walt@example.com.", Entities{{Kind: EntityMention, Text: "walt@example.com", Start: 3, End: 20}}},
+		{"walt@example.com and @walt aren't mentions", nil},
+	}
+	for _, test := range tests {
+		got := parseEntities(test.body)
+		if !reflect.DeepEqual(got, test.want) {
+			t.Errorf("parseEntities(%q) = %+v, want %+v", test.body, got, test.want)
+		}
+	}
+}
+
+func TestHashtagsAndMentions(t *testing.T) {
+	for name, db := range openStores(t) {
+		t.Run(name, func(t *testing.T) {
+			walt, err := db.CreateUser("Walt@example.com", "hash")
+			if err != nil {
+				t.Fatal(err)
+			}
+			chirp, err := db.CreateChirp("#Chemistry with @walt@example.com and @nobody@example.com", "2")
+			if err != nil {
+				t.Fatal(err)
+			}
+			want := Entities{
+				{Kind: EntityHashtag, Text: "Chemistry", Start: 0, End: 10},
+				{Kind: EntityMention, Start: 16, End: 33, UserId: walt.Id},
+			}
+			if !reflect.DeepEqual(chirp.Entities, want) {
+				t.Fatalf("got entities %+v, want %+v", chirp.Entities, want)
+			}
+			found, err := db.GetChirp(chirp.Id)
+			if err != nil || !reflect.DeepEqual(found.Entities, want) {
+				t.Fatalf("got stored entities %+v, %v, want %+v", found.Entities, err, want)
+			}
+			_, err = db.CreateChirp("no tags", "2")
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			tagged, err := db.QueryChirps(ChirpQuery{Hashtag: "chemistry"})
+			if err != nil || len(tagged) != 1 || tagged[0].Id != chirp.Id {
+				t.Fatalf("got %+v, %v, want chirp %d for #chemistry", tagged, err, chirp.Id)
+			}
+			mentions, err := db.QueryChirps(ChirpQuery{MentionOf: walt.Id})
+			if err != nil || len(mentions) != 1 || mentions[0].Id != chirp.Id {
+				t.Fatalf("got %+v, %v, want chirp %d mentioning walt", mentions, err, chirp.Id)
+			}
+
+			// Edits find the entities again.
+			_, err = db.EditChirp(chirp.Id, 2, "#physics now")
+			if err != nil {
+				t.Fatal(err)
+			}
+			for _, query := range []ChirpQuery{{Hashtag: "chemistry"}, {MentionOf: walt.Id}} {
+				chirps, err := db.QueryChirps(query)
+				if err != nil || len(chirps) != 0 {
+					t.Fatalf("got %+v, %v for %+v after editing, want none", chirps, err, query)
+				}
+			}
+			tagged, err = db.QueryChirps(ChirpQuery{Hashtag: "Physics"})
+			if err != nil || len(tagged) != 1 {
+				t.Fatalf("got %+v, %v, want the edited chirp for #physics", tagged, err)
+			}
+
+			err = db.DeleteChirp("1")
+			if err != nil {
+				t.Fatal(err)
+			}
+			tagged, err = db.QueryChirps(ChirpQuery{Hashtag: "physics"})
+			if err != nil || len(tagged) != 0 {
+				t.Fatalf("got %+v, %v, want deleted chirps untagged", tagged, err)
+			}
+		})
+	}
+}
@@ -0,0 +1,19 @@
+package database
+
+import "errors"
+
+// Errors the store returns for expected conditions, compare
+// against them with errors.Is
+var (
+	ErrNotFound       = errors.New("Not found!")
+	ErrForbidden      = errors.New("Forbidden!")
+	ErrDuplicateEmail = errors.New("Email already exists!")
+	ErrRevoked        = errors.New("Token has been revoked!")
+	ErrNoParent       = errors.New("The chirp replied to doesn't exist!")
+	ErrRechirped      = errors.New("Chirp has already been rechirped!")
+	ErrSelfFollow     = errors.New("Users can't follow themselves!")
+	ErrReported       = errors.New("Chirp has already been reported!")
+	ErrResolved       = errors.New("Report has already been resolved!")
+	ErrSelfBlock      = errors.New("Users can't block or mute themselves!")
+	ErrBlocked        = errors.New("You have been blocked by this user!")
+)
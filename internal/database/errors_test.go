@@ -0,0 +1,57 @@
+package database
+
+import (
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestSentinelErrors(t *testing.T) {
+	for name, db := range openStores(t) {
+		t.Run(name, func(t *testing.T) {
+			_, err := db.UpgradeUser(42)
+			if !errors.Is(err, ErrNotFound) {
+				t.Fatalf("upgrading a missing user: got %v, want ErrNotFound", err)
+			}
+			_, err = db.UpdateUser(42, "walt@example.com", "password")
+			if !errors.Is(err, ErrNotFound) {
+				t.Fatalf("updating a missing user: got %v, want ErrNotFound", err)
+			}
+			users, err := db.GetUsers()
+			if err != nil || len(users) != 0 {
+				t.Fatalf("got %+v, %v, want no users to have been created", users, err)
+			}
+
+			_, err = db.CreateUser("walt@example.com", "hash")
+			if err != nil {
+				t.Fatal(err)
+			}
+			_, err = db.CreateUser("walt@example.com", "hash")
+			if !errors.Is(err, ErrDuplicateEmail) {
+				t.Fatalf("got %v, want ErrDuplicateEmail", err)
+			}
+
+			_, err = db.CreateChirp("hello", "1")
+			if err != nil {
+				t.Fatal(err)
+			}
+			err = db.ChirpBelongsToUser("1", "2")
+			if !errors.Is(err, ErrForbidden) {
+				t.Fatalf("got %v, want ErrForbidden", err)
+			}
+			_, err = db.GetChirp(42)
+			if !errors.Is(err, ErrNotFound) {
+				t.Fatalf("got %v, want ErrNotFound", err)
+			}
+
+			err = db.RevokeToken("some.jwt", time.Now().Add(time.Hour))
+			if err != nil {
+				t.Fatal(err)
+			}
+			err = db.CheckRevocation("some.jwt")
+			if !errors.Is(err, ErrRevoked) {
+				t.Fatalf("got %v, want ErrRevoked", err)
+			}
+		})
+	}
+}
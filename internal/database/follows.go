@@ -0,0 +1,124 @@
+package database
+
+import (
+	"errors"
+	"time"
+)
+
+// Follow records that a user follows another, a user follows another at most once
+type Follow struct {
+	FollowerId int       `json:"follower_id"`
+	FolloweeId int       `json:"followee_id"`
+	CreatedAt  time.Time `json:"created_at"`
+}
+
+// FollowUser makes followerId follow followeeId, following again changes nothing
+func (s txStore) FollowUser(followerId int, followeeId int) error {
+	if followerId == followeeId {
+		return ErrSelfFollow
+	}
+	return s.backend.Update(func(tx Tx) error {
+		_, err := tx.GetUser(followeeId)
+		if err != nil {
+			return err
+		}
+		err = checkBlocked(tx, followerId, followeeId)
+		if err != nil {
+			return err
+		}
+		_, err = tx.GetFollow(followerId, followeeId)
+		if !errors.Is(err, ErrNotFound) {
+			return err
+		}
+		return tx.PutFollow(Follow{FollowerId: followerId, FolloweeId: followeeId, CreatedAt: time.Now().UTC()})
+	})
+}
+
+// UnfollowUser makes followerId stop following followeeId, if it does
+func (s txStore) UnfollowUser(followerId int, followeeId int) error {
+	return s.backend.Update(func(tx Tx) error {
+		_, err := tx.GetUser(followeeId)
+		if err != nil {
+			return err
+		}
+		_, err = tx.GetFollow(followerId, followeeId)
+		if errors.Is(err, ErrNotFound) {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		return tx.DeleteFollow(followerId, followeeId)
+	})
+}
+
+// GetFollowers returns the users following userId, newest follower first
+func (s txStore) GetFollowers(userId int) ([]User, error) {
+	return s.followUsers(userId, func(tx Tx) ([]Follow, error) {
+		return tx.GetFollowsOf(userId)
+	}, func(follow Follow) int {
+		return follow.FollowerId
+	})
+}
+
+// GetFollowing returns the users userId follows, most recently followed first
+func (s txStore) GetFollowing(userId int) ([]User, error) {
+	return s.followUsers(userId, func(tx Tx) ([]Follow, error) {
+		return tx.GetFollowsBy(userId)
+	}, func(follow Follow) int {
+		return follow.FolloweeId
+	})
+}
+
+// followUsers loads the users on the other end of the follows of
+// userId that follows returns, other picking the user from a follow
+func (s txStore) followUsers(userId int, follows func(tx Tx) ([]Follow, error), other func(follow Follow) int) ([]User, error) {
+	users := []User{}
+	err := s.backend.View(func(tx Tx) error {
+		_, err := tx.GetUser(userId)
+		if err != nil {
+			return err
+		}
+		userFollows, err := follows(tx)
+		if err != nil {
+			return err
+		}
+		for _, follow := range userFollows {
+			user, err := tx.GetUser(other(follow))
+			if err != nil {
+				return err
+			}
+			users = append(users, user)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return users, nil
+}
+
+// GetTimeline runs query over the chirps of userId and of the users
+// it follows as it sees them, whatever its AuthorIds and ViewerId are,
+// leaving out the users it muted
+func (s txStore) GetTimeline(userId int, query ChirpQuery) ([]Chirp, error) {
+	var chirps []Chirp
+	err := s.backend.View(func(tx Tx) error {
+		follows, err := tx.GetFollowsBy(userId)
+		if err != nil {
+			return err
+		}
+		query.AuthorIds = []int{userId}
+		query.MutedBy = userId
+		query.ViewerId = userId
+		for _, follow := range follows {
+			query.AuthorIds = append(query.AuthorIds, follow.FolloweeId)
+		}
+		chirps, err = tx.QueryChirps(query)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	return chirps, nil
+}
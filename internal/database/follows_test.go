@@ -0,0 +1,87 @@
+package database
+
+import (
+	"errors"
+	"strconv"
+	"testing"
+)
+
+func TestFollows(t *testing.T) {
+	for name, db := range openStores(t) {
+		t.Run(name, func(t *testing.T) {
+			for _, email := range []string{"walt@example.com", "jesse@example.com", "skyler@example.com"} {
+				user, err := db.CreateUser(email, "hash")
+				if err != nil {
+					t.Fatal(err)
+				}
+				_, err = db.CreateChirp("hello from "+email, strconv.Itoa(user.Id))
+				if err != nil {
+					t.Fatal(err)
+				}
+			}
+
+			err := db.FollowUser(1, 1)
+			if !errors.Is(err, ErrSelfFollow) {
+				t.Fatalf("following oneself: got %v, want ErrSelfFollow", err)
+			}
+			err = db.FollowUser(1, 42)
+			if !errors.Is(err, ErrNotFound) {
+				t.Fatalf("following a missing user: got %v, want ErrNotFound", err)
+			}
+			for i := 0; i < 2; i++ {
+				err = db.FollowUser(1, 2)
+				if err != nil {
+					t.Fatal(err)
+				}
+			}
+			err = db.FollowUser(3, 2)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			followers, err := db.GetFollowers(2)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(followers) != 2 || followers[0].Id != 3 || followers[1].Id != 1 {
+				t.Fatalf("got followers %+v of user 2, want users 3 and 1", followers)
+			}
+			following, err := db.GetFollowing(1)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(following) != 1 || following[0].Id != 2 {
+				t.Fatalf("got %+v followed by user 1, want user 2", following)
+			}
+
+			timeline, err := db.GetTimeline(1, ChirpQuery{Desc: true})
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(timeline) != 2 || timeline[0].Id != 2 || timeline[1].Id != 1 {
+				t.Fatalf("got timeline %+v, want chirps 2 and 1", timeline)
+			}
+			timeline, err = db.GetTimeline(1, ChirpQuery{Desc: true, After: timeline[0], Limit: 1})
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(timeline) != 1 || timeline[0].Id != 1 {
+				t.Fatalf("got second page %+v, want chirp 1", timeline)
+			}
+
+			for i := 0; i < 2; i++ {
+				err = db.UnfollowUser(1, 2)
+				if err != nil {
+					t.Fatal(err)
+				}
+			}
+			timeline, err = db.GetTimeline(1, ChirpQuery{})
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(timeline) != 1 || timeline[0].Id != 1 {
+				t.Fatalf("got timeline %+v after unfollowing, want chirp 1", timeline)
+			}
+		})
+	}
+}
@@ -0,0 +1,92 @@
+package database
+
+import (
+	"errors"
+	"path/filepath"
+	"testing"
+)
+
+func TestEditChirp(t *testing.T) {
+	for name, db := range openStores(t) {
+		t.Run(name, func(t *testing.T) {
+			chirp, err := db.CreateChirp("first", "1")
+			if err != nil {
+				t.Fatal(err)
+			}
+			_, err = db.EditChirp(chirp.Id, 2, "not mine")
+			if !errors.Is(err, ErrForbidden) {
+				t.Fatalf("got %v, want ErrForbidden", err)
+			}
+			_, err = db.EditChirp(42, 1, "missing")
+			if !errors.Is(err, ErrNotFound) {
+				t.Fatalf("got %v, want ErrNotFound", err)
+			}
+			for _, body := range []string{"second", "third"} {
+				edited, err := db.EditChirp(chirp.Id, 1, body)
+				if err != nil {
+					t.Fatal(err)
+				}
+				if edited.Body != body || !edited.UpdatedAt.After(edited.CreatedAt) {
+					t.Fatalf("got %+v after editing to %q", edited, body)
+				}
+			}
+			history, err := db.GetChirpHistory(chirp.Id)
+			if err != nil {
+				t.Fatal(err)
+			}
+			want := []string{"first", "second", "third"}
+			if len(history) != len(want) {
+				t.Fatalf("got %d versions, want %d", len(history), len(want))
+			}
+			for i, version := range history {
+				if version.Version != i+1 || version.Body != want[i] {
+					t.Fatalf("version %d is %+v, want body %q", i+1, version, want[i])
+				}
+			}
+			if !history[0].CreatedAt.Equal(chirp.CreatedAt) {
+				t.Fatalf("first version written at %s, want the chirp's creation %s", history[0].CreatedAt, chirp.CreatedAt)
+			}
+
+			err = db.DeleteChirp("1")
+			if err != nil {
+				t.Fatal(err)
+			}
+			_, err = db.GetChirpHistory(chirp.Id)
+			if !errors.Is(err, ErrNotFound) {
+				t.Fatalf("got %v for the history of a deleted chirp, want ErrNotFound", err)
+			}
+		})
+	}
+}
+
+func TestReplayChirpVersions(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "database.json")
+	db, err := NewDB(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	chirp, err := db.CreateChirp("first", "1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	version := ChirpVersion{ChirpId: chirp.Id, Version: 1, Body: "first", CreatedAt: chirp.CreatedAt}
+	chirp.Body = "second"
+	// Replaying the same entries twice must not duplicate the version.
+	entries := []journalEntry{addChirpVersionEntry(version), putChirpEntry(chirp)}
+	err = db.appendJournal(append(entries, entries...))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	db, err = NewDB(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	history, err := db.GetChirpHistory(chirp.Id)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(history) != 2 || history[0].Body != "first" || history[1].Body != "second" {
+		t.Fatalf("got history %+v", history)
+	}
+}
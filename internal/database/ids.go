@@ -0,0 +1,88 @@
+package database
+
+import (
+	"crypto/rand"
+	"encoding/binary"
+	"encoding/hex"
+	"fmt"
+	"time"
+)
+
+// Id schemes for Config.IdScheme. Records always get a sequential
+// integer id, the opaque schemes additionally give them a uid.
+const (
+	IdSchemeSequence = "sequence"
+	IdSchemeULID     = "ulid"
+	IdSchemeUUIDv7   = "uuidv7"
+)
+
+// Sequence names, one per table with integer ids
+const (
+	sequenceChirps  = "chirps"
+	sequenceUsers   = "users"
+	sequenceReports = "reports"
+)
+
+// advanceSequence makes sure the sequence for table never hands out id again
+func (dbStructure *DBStructure) advanceSequence(table string, id int) {
+	if id > dbStructure.Sequences[table] {
+		dbStructure.Sequences[table] = id
+	}
+}
+
+// newUid returns a fresh opaque id in scheme,
+// or "" if the scheme doesn't use them
+func newUid(scheme string) (string, error) {
+	switch scheme {
+	case "", IdSchemeSequence:
+		return "", nil
+	case IdSchemeULID:
+		return newULID(time.Now())
+	case IdSchemeUUIDv7:
+		return newUUIDv7(time.Now())
+	}
+	return "", fmt.Errorf("Unknown id scheme %q!", scheme)
+}
+
+// timestampedRandom returns 16 bytes, the first 6 holding the
+// milliseconds since the epoch and the rest random
+func timestampedRandom(now time.Time) ([16]byte, error) {
+	var b [16]byte
+	var ms [8]byte
+	binary.BigEndian.PutUint64(ms[:], uint64(now.UnixMilli()))
+	copy(b[:6], ms[2:])
+	_, err := rand.Read(b[6:])
+	return b, err
+}
+
+const crockford = "0123456789ABCDEFGHJKMNPQRSTVWXYZ"
+
+// newULID returns a ULID, 26 Crockford base32 characters
+func newULID(now time.Time) (string, error) {
+	b, err := timestampedRandom(now)
+	if err != nil {
+		return "", err
+	}
+	// 128 bits as 26 characters of 5 bits, the first holding only 3.
+	hi := binary.BigEndian.Uint64(b[:8])
+	lo := binary.BigEndian.Uint64(b[8:])
+	var ulid [26]byte
+	for i := 25; i >= 0; i-- {
+		ulid[i] = crockford[lo&31]
+		lo = lo>>5 | hi<<59
+		hi >>= 5
+	}
+	return string(ulid[:]), nil
+}
+
+// newUUIDv7 returns a version 7 UUID as defined in RFC 9562
+func newUUIDv7(now time.Time) (string, error) {
+	b, err := timestampedRandom(now)
+	if err != nil {
+		return "", err
+	}
+	b[6] = b[6]&0x0f | 0x70
+	b[8] = b[8]&0x3f | 0x80
+	h := hex.EncodeToString(b[:])
+	return h[:8] + "-" + h[8:12] + "-" + h[12:16] + "-" + h[16:20] + "-" + h[20:], nil
+}
@@ -0,0 +1,125 @@
+package database
+
+import (
+	"path/filepath"
+	"reflect"
+	"regexp"
+	"testing"
+	"time"
+)
+
+func TestIdsAreNotReused(t *testing.T) {
+	for name, db := range openStores(t) {
+		t.Run(name, func(t *testing.T) {
+			for i := 0; i < 2; i++ {
+				_, err := db.CreateChirp("hello", "1")
+				if err != nil {
+					t.Fatal(err)
+				}
+			}
+			err := db.DeleteChirp("2")
+			if err != nil {
+				t.Fatal(err)
+			}
+			chirp, err := db.CreateChirp("hello again", "1")
+			if err != nil {
+				t.Fatal(err)
+			}
+			if chirp.Id != 3 {
+				t.Fatalf("got chirp id %d after deleting chirp 2, want 3", chirp.Id)
+			}
+		})
+	}
+}
+
+func TestIdsSurviveReopen(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "database.json")
+	db, err := NewDB(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = db.CreateUser("walt@example.com", "hash")
+	if err != nil {
+		t.Fatal(err)
+	}
+	dbStructure, _ := db.LoadDB()
+	delete(dbStructure.Users, 1)
+	err = db.writeDB(dbStructure)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	db, err = NewDB(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	user, err := db.CreateUser("jesse@example.com", "hash")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if user.Id != 2 {
+		t.Fatalf("got user id %d, want 2", user.Id)
+	}
+}
+
+func TestGetChirpByUid(t *testing.T) {
+	dir := t.TempDir()
+	stores := map[string]Config{
+		"json/ulid":     {Driver: "json", Path: filepath.Join(dir, "database.json"), IdScheme: IdSchemeULID},
+		"sqlite/uuidv7": {Driver: "sqlite", Path: filepath.Join(dir, "database.sqlite"), IdScheme: IdSchemeUUIDv7},
+	}
+	for name, cfg := range stores {
+		t.Run(name, func(t *testing.T) {
+			db, err := Open(cfg)
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer db.Close()
+			chirp, err := db.CreateChirp("hello", "1")
+			if err != nil {
+				t.Fatal(err)
+			}
+			if chirp.Uid == "" {
+				t.Fatal("chirp created without a uid")
+			}
+			found, err := db.GetChirpByUid(chirp.Uid)
+			if err != nil || !reflect.DeepEqual(found, chirp) {
+				t.Fatalf("got %+v, %v, want %+v", found, err, chirp)
+			}
+			err = db.DeleteChirp("1")
+			if err != nil {
+				t.Fatal(err)
+			}
+			_, err = db.GetChirpByUid(chirp.Uid)
+			if err == nil {
+				t.Fatal("deleted chirp still resolves by uid")
+			}
+			_, err = db.GetChirpByUid("")
+			if err == nil {
+				t.Fatal("the empty uid resolved to a chirp")
+			}
+		})
+	}
+}
+
+func TestUidFormats(t *testing.T) {
+	now := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	ulid, err := newULID(now)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !regexp.MustCompile(`^01HK[0-9A-HJKMNP-TV-Z]{22}$`).MatchString(ulid) {
+		t.Fatalf("malformed ULID %s", ulid)
+	}
+	uuid, err := newUUIDv7(now)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !regexp.MustCompile(`^018cc251-f400-7[0-9a-f]{3}-[89ab][0-9a-f]{3}-[0-9a-f]{12}$`).MatchString(uuid) {
+		t.Fatalf("malformed UUIDv7 %s", uuid)
+	}
+	_, err = Open(Config{Path: filepath.Join(t.TempDir(), "database.json"), IdScheme: "snowflake"})
+	if err == nil {
+		t.Fatal("opened a store with an unknown id scheme")
+	}
+}
@@ -0,0 +1,151 @@
+package database
+
+import "strings"
+
+// normalizeEmail is the form emails are compared and indexed in
+func normalizeEmail(email string) string {
+	return strings.ToLower(email)
+}
+
+// buildIndexes rebuilds the secondary indexes from the tables
+func (dbStructure *DBStructure) buildIndexes() {
+	dbStructure.chirpsByAuthor = make(map[int]map[int]struct{})
+	dbStructure.chirpIdsByUid = make(map[string]int)
+	dbStructure.repliesByChirp = make(map[int]map[int]struct{})
+	dbStructure.refsByChirp = make(map[int]map[int]struct{})
+	dbStructure.chirpsByTag = make(map[string]map[int]struct{})
+	dbStructure.mentionsOf = make(map[int]map[int]struct{})
+	dbStructure.searchIndex = make(map[string]map[int][]int)
+	dbStructure.searchDocs = 0
+	dbStructure.searchTokens = 0
+	dbStructure.likesByUser = make(map[int]map[int]struct{})
+	dbStructure.followersOf = make(map[int]map[int]struct{})
+	dbStructure.userIdsByEmail = make(map[string]int, len(dbStructure.Users))
+	for _, chirp := range dbStructure.Chirps {
+		dbStructure.indexChirp(chirp)
+	}
+	for _, user := range dbStructure.Users {
+		dbStructure.indexUser(user)
+	}
+	for chirpId, likes := range dbStructure.Likes {
+		for userId := range likes {
+			addToSet(dbStructure.likesByUser, userId, chirpId)
+		}
+	}
+	for followerId, follows := range dbStructure.Follows {
+		for followeeId := range follows {
+			addToSet(dbStructure.followersOf, followeeId, followerId)
+		}
+	}
+}
+
+// addToSet adds id to the set stored under key in sets
+func addToSet(sets map[int]map[int]struct{}, key int, id int) {
+	set, ok := sets[key]
+	if !ok {
+		set = make(map[int]struct{})
+		sets[key] = set
+	}
+	set[id] = struct{}{}
+}
+
+// removeFromSet removes id from the set under key, dropping the set once empty
+func removeFromSet(sets map[int]map[int]struct{}, key int, id int) {
+	set := sets[key]
+	delete(set, id)
+	if len(set) == 0 {
+		delete(sets, key)
+	}
+}
+
+// indexChirp adds chirp to the indexes. Tombstones and hidden chirps
+// are only indexed as replies and rechirps, they are found through
+// their thread.
+func (dbStructure *DBStructure) indexChirp(chirp Chirp) {
+	if chirp.InReplyTo != 0 {
+		addToSet(dbStructure.repliesByChirp, chirp.InReplyTo, chirp.Id)
+	}
+	if chirp.RefChirpId != 0 {
+		addToSet(dbStructure.refsByChirp, chirp.RefChirpId, chirp.Id)
+	}
+	if !chirp.listed() {
+		return
+	}
+	addToSet(dbStructure.chirpsByAuthor, chirp.AuthorId, chirp.Id)
+	if chirp.Uid != "" {
+		dbStructure.chirpIdsByUid[chirp.Uid] = chirp.Id
+	}
+	for _, tag := range chirp.hashtags() {
+		chirpIds, ok := dbStructure.chirpsByTag[tag]
+		if !ok {
+			chirpIds = make(map[int]struct{})
+			dbStructure.chirpsByTag[tag] = chirpIds
+		}
+		chirpIds[chirp.Id] = struct{}{}
+	}
+	for _, userId := range chirp.mentions() {
+		addToSet(dbStructure.mentionsOf, userId, chirp.Id)
+	}
+	tokens := 0
+	for term, positions := range termPositions(chirp.Body) {
+		postings, ok := dbStructure.searchIndex[term]
+		if !ok {
+			postings = make(map[int][]int)
+			dbStructure.searchIndex[term] = postings
+		}
+		postings[chirp.Id] = positions
+		tokens += len(positions)
+	}
+	if tokens > 0 {
+		dbStructure.searchDocs++
+		dbStructure.searchTokens += tokens
+	}
+}
+
+func (dbStructure *DBStructure) unindexChirp(chirp Chirp) {
+	if chirp.InReplyTo != 0 {
+		removeFromSet(dbStructure.repliesByChirp, chirp.InReplyTo, chirp.Id)
+	}
+	if chirp.RefChirpId != 0 {
+		removeFromSet(dbStructure.refsByChirp, chirp.RefChirpId, chirp.Id)
+	}
+	if !chirp.listed() {
+		return
+	}
+	removeFromSet(dbStructure.chirpsByAuthor, chirp.AuthorId, chirp.Id)
+	delete(dbStructure.chirpIdsByUid, chirp.Uid)
+	for _, tag := range chirp.hashtags() {
+		chirpIds := dbStructure.chirpsByTag[tag]
+		delete(chirpIds, chirp.Id)
+		if len(chirpIds) == 0 {
+			delete(dbStructure.chirpsByTag, tag)
+		}
+	}
+	for _, userId := range chirp.mentions() {
+		removeFromSet(dbStructure.mentionsOf, userId, chirp.Id)
+	}
+	tokens := 0
+	for term, positions := range termPositions(chirp.Body) {
+		postings := dbStructure.searchIndex[term]
+		delete(postings, chirp.Id)
+		if len(postings) == 0 {
+			delete(dbStructure.searchIndex, term)
+		}
+		tokens += len(positions)
+	}
+	if tokens > 0 {
+		dbStructure.searchDocs--
+		dbStructure.searchTokens -= tokens
+	}
+}
+
+func (dbStructure *DBStructure) indexUser(user User) {
+	dbStructure.userIdsByEmail[normalizeEmail(user.Email)] = user.Id
+}
+
+func (dbStructure *DBStructure) unindexUser(user User) {
+	email := normalizeEmail(user.Email)
+	if dbStructure.userIdsByEmail[email] == user.Id {
+		delete(dbStructure.userIdsByEmail, email)
+	}
+}
@@ -0,0 +1,179 @@
+package database
+
+import (
+	"database/sql"
+	"fmt"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestGetChirpsByAuthor(t *testing.T) {
+	for name, db := range openStores(t) {
+		t.Run(name, func(t *testing.T) {
+			for _, authorId := range []string{"1", "2", "1"} {
+				_, err := db.CreateChirp("by "+authorId, authorId)
+				if err != nil {
+					t.Fatal(err)
+				}
+			}
+			err := db.DeleteChirp("1")
+			if err != nil {
+				t.Fatal(err)
+			}
+			chirps, err := db.GetChirpsByAuthor(1)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(chirps) != 1 || chirps[0].Id != 3 {
+				t.Fatalf("got %+v, want only chirp 3", chirps)
+			}
+			chirps, err = db.GetChirpsByAuthor(42)
+			if err != nil || len(chirps) != 0 {
+				t.Fatalf("got %+v, %v for an author without chirps", chirps, err)
+			}
+		})
+	}
+}
+
+func TestGetUserByEmail(t *testing.T) {
+	for name, db := range openStores(t) {
+		t.Run(name, func(t *testing.T) {
+			user, err := db.CreateUser("Walt@Example.com", "hash")
+			if err != nil {
+				t.Fatal(err)
+			}
+			_, err = db.CreateUser("walt@example.COM", "hash")
+			if err == nil {
+				t.Fatal("created a second user with the same email")
+			}
+			found, err := db.GetUserByEmail("WALT@example.com")
+			if err != nil || found.Id != user.Id {
+				t.Fatalf("got %+v, %v, want user %d", found, err, user.Id)
+			}
+
+			// Keeping your own email while changing the password is fine.
+			_, err = db.UpdateUser(user.Id, "walt@example.com", "new password")
+			if err != nil {
+				t.Fatal(err)
+			}
+			_, err = db.UpdateUser(user.Id, "heisenberg@example.com", "new password")
+			if err != nil {
+				t.Fatal(err)
+			}
+			_, err = db.GetUserByEmail("walt@example.com")
+			if err == nil {
+				t.Fatal("old email still resolves after the update")
+			}
+			found, err = db.GetUserByEmail("heisenberg@example.com")
+			if err != nil || found.Id != user.Id {
+				t.Fatalf("got %+v, %v, want user %d", found, err, user.Id)
+			}
+		})
+	}
+}
+
+const benchmarkRows = 100000
+
+// benchmarkStores returns a JSON and a SQLite store holding
+// benchmarkRows chirps spread over 1000 authors and benchmarkRows users
+func benchmarkStores(b *testing.B) map[string]Store {
+	b.Helper()
+	dir := b.TempDir()
+
+	// Filling the JSON store through CreateChirp would rewrite the file
+	// for every row, build the in-memory data directly instead.
+	jsonDB, err := Open(Config{Path: filepath.Join(dir, "database.json"), FlushInterval: time.Hour})
+	if err != nil {
+		b.Fatal(err)
+	}
+	db := jsonDB.(*DB)
+	for i := 1; i <= benchmarkRows; i++ {
+		db.data.Chirps[i] = Chirp{Id: i, Body: "chirp", AuthorId: i % 1000}
+		db.data.Users[i] = User{Id: i, Email: fmt.Sprintf("User%d@example.com", i), Password: "hash"}
+	}
+	db.data.buildIndexes()
+
+	sqliteDB, err := Open(Config{Driver: "sqlite", Path: filepath.Join(dir, "database.sqlite")})
+	if err != nil {
+		b.Fatal(err)
+	}
+	err = sqliteDB.(*SQLiteDB).update(func(tx *sql.Tx) error {
+		for i := 1; i <= benchmarkRows; i++ {
+			_, err := tx.Exec("INSERT INTO chirps (id, body, author_id) VALUES (?, 'chirp', ?)", i, i%1000)
+			if err != nil {
+				return err
+			}
+			email := fmt.Sprintf("User%d@example.com", i)
+			_, err = tx.Exec("INSERT INTO users (id, email, email_lower, password) VALUES (?, ?, ?, 'hash')", i, email, normalizeEmail(email))
+			if err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		b.Fatal(err)
+	}
+	b.Cleanup(func() {
+		jsonDB.Close()
+		sqliteDB.Close()
+	})
+	return map[string]Store{"json": jsonDB, "sqlite": sqliteDB}
+}
+
+func BenchmarkChirpsByAuthor(b *testing.B) {
+	for name, db := range benchmarkStores(b) {
+		b.Run(name+"/scan", func(b *testing.B) {
+			for i := 0; i < b.N; i++ {
+				chirps, err := db.GetChirps()
+				if err != nil {
+					b.Fatal(err)
+				}
+				var filtered []Chirp
+				for _, chirp := range chirps {
+					if chirp.AuthorId == 7 {
+						filtered = append(filtered, chirp)
+					}
+				}
+			}
+		})
+		b.Run(name+"/index", func(b *testing.B) {
+			for i := 0; i < b.N; i++ {
+				_, err := db.GetChirpsByAuthor(7)
+				if err != nil {
+					b.Fatal(err)
+				}
+			}
+		})
+	}
+}
+
+func BenchmarkUserByEmail(b *testing.B) {
+	for name, db := range benchmarkStores(b) {
+		email := "user" + strconv.Itoa(benchmarkRows/2) + "@EXAMPLE.com"
+		b.Run(name+"/scan", func(b *testing.B) {
+			for i := 0; i < b.N; i++ {
+				users, err := db.GetUsers()
+				if err != nil {
+					b.Fatal(err)
+				}
+				for _, user := range users {
+					if strings.ToLower(user.Email) == strings.ToLower(email) {
+						break
+					}
+				}
+			}
+		})
+		b.Run(name+"/index", func(b *testing.B) {
+			for i := 0; i < b.N; i++ {
+				_, err := db.GetUserByEmail(email)
+				if err != nil {
+					b.Fatal(err)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,511 @@
+package database
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"errors"
+	"log"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// journalEntry is a single mutation in the append-only journal.
+// Entries hold the resulting record rather than the operation's
+// arguments, so replaying an entry twice is harmless.
+type journalEntry struct {
+	Op           string        `json:"op"`
+	Chirp        *Chirp        `json:"chirp,omitempty"`
+	User         *User         `json:"user,omitempty"`
+	Id           int           `json:"id,omitempty"`
+	Token        string        `json:"token,omitempty"`
+	RevokedToken *RevokedToken `json:"revoked_token,omitempty"`
+	ChirpVersion *ChirpVersion `json:"chirp_version,omitempty"`
+	Like         *Like         `json:"like,omitempty"`
+	Follow       *Follow       `json:"follow,omitempty"`
+	BannedWord   *BannedWord   `json:"banned_word,omitempty"`
+	Report       *Report       `json:"report,omitempty"`
+	Block        *Block        `json:"block,omitempty"`
+	Mute         *Mute         `json:"mute,omitempty"`
+	Time         time.Time     `json:"time,omitempty"`
+}
+
+const (
+	opPutChirp    = "put_chirp"
+	opDeleteChirp = "delete_chirp"
+	opPutUser     = "put_user"
+	opRevokeToken = "revoke_token"
+	opPruneTokens = "prune_tokens"
+
+	opAddChirpVersion  = "add_chirp_version"
+	opPutChirpVersion  = "put_chirp_version"
+	opPutLike          = "put_like"
+	opDeleteLike       = "delete_like"
+	opPutFollow        = "put_follow"
+	opDeleteFollow     = "delete_follow"
+	opPutBannedWord    = "put_banned_word"
+	opDeleteBannedWord = "delete_banned_word"
+	opPutReport        = "put_report"
+	opPutBlock         = "put_block"
+	opDeleteBlock      = "delete_block"
+	opPutMute          = "put_mute"
+	opDeleteMute       = "delete_mute"
+)
+
+func putChirpEntry(chirp Chirp) journalEntry {
+	return journalEntry{Op: opPutChirp, Chirp: &chirp}
+}
+
+func deleteChirpEntry(id int) journalEntry {
+	return journalEntry{Op: opDeleteChirp, Id: id}
+}
+
+func putUserEntry(user User) journalEntry {
+	return journalEntry{Op: opPutUser, User: &user}
+}
+
+func revokeTokenEntry(token string, revokedToken RevokedToken) journalEntry {
+	return journalEntry{Op: opRevokeToken, Token: token, RevokedToken: &revokedToken}
+}
+
+func pruneTokensEntry(now time.Time) journalEntry {
+	return journalEntry{Op: opPruneTokens, Time: now}
+}
+
+func addChirpVersionEntry(version ChirpVersion) journalEntry {
+	return journalEntry{Op: opAddChirpVersion, ChirpVersion: &version}
+}
+
+func putChirpVersionEntry(version ChirpVersion) journalEntry {
+	return journalEntry{Op: opPutChirpVersion, ChirpVersion: &version}
+}
+
+func putLikeEntry(like Like) journalEntry {
+	return journalEntry{Op: opPutLike, Like: &like}
+}
+
+func deleteLikeEntry(like Like) journalEntry {
+	return journalEntry{Op: opDeleteLike, Like: &like}
+}
+
+func putFollowEntry(follow Follow) journalEntry {
+	return journalEntry{Op: opPutFollow, Follow: &follow}
+}
+
+func deleteFollowEntry(follow Follow) journalEntry {
+	return journalEntry{Op: opDeleteFollow, Follow: &follow}
+}
+
+func putBannedWordEntry(word BannedWord) journalEntry {
+	return journalEntry{Op: opPutBannedWord, BannedWord: &word}
+}
+
+func deleteBannedWordEntry(word string) journalEntry {
+	return journalEntry{Op: opDeleteBannedWord, BannedWord: &BannedWord{Word: word}}
+}
+
+func putReportEntry(report Report) journalEntry {
+	return journalEntry{Op: opPutReport, Report: &report}
+}
+
+func putBlockEntry(block Block) journalEntry {
+	return journalEntry{Op: opPutBlock, Block: &block}
+}
+
+func deleteBlockEntry(block Block) journalEntry {
+	return journalEntry{Op: opDeleteBlock, Block: &block}
+}
+
+func putMuteEntry(mute Mute) journalEntry {
+	return journalEntry{Op: opPutMute, Mute: &mute}
+}
+
+func deleteMuteEntry(mute Mute) journalEntry {
+	return journalEntry{Op: opDeleteMute, Mute: &mute}
+}
+
+// apply replays the entry onto dbStructure
+func (entry journalEntry) apply(dbStructure *DBStructure) error {
+	switch entry.Op {
+	case opPutChirp:
+		if old, ok := dbStructure.Chirps[entry.Chirp.Id]; ok {
+			dbStructure.unindexChirp(old)
+		}
+		dbStructure.Chirps[entry.Chirp.Id] = *entry.Chirp
+		dbStructure.indexChirp(*entry.Chirp)
+		dbStructure.advanceSequence(sequenceChirps, entry.Chirp.Id)
+	case opDeleteChirp:
+		if old, ok := dbStructure.Chirps[entry.Id]; ok {
+			dbStructure.unindexChirp(old)
+		}
+		delete(dbStructure.Chirps, entry.Id)
+		delete(dbStructure.History, entry.Id)
+		for userId := range dbStructure.Likes[entry.Id] {
+			removeFromSet(dbStructure.likesByUser, userId, entry.Id)
+		}
+		delete(dbStructure.Likes, entry.Id)
+	case opPutUser:
+		if old, ok := dbStructure.Users[entry.User.Id]; ok {
+			dbStructure.unindexUser(old)
+		}
+		dbStructure.Users[entry.User.Id] = *entry.User
+		dbStructure.indexUser(*entry.User)
+		dbStructure.advanceSequence(sequenceUsers, entry.User.Id)
+	case opRevokeToken:
+		if entry.RevokedToken == nil {
+			// Written before expiries were recorded.
+			entry.RevokedToken = &RevokedToken{RevokedAt: entry.Time, ExpiresAt: entry.Time.Add(legacyTokenLifetime)}
+		}
+		dbStructure.Tokens[entry.Token] = *entry.RevokedToken
+	case opPruneTokens:
+		for token, revokedToken := range dbStructure.Tokens {
+			if revokedToken.ExpiresAt.Before(entry.Time) {
+				delete(dbStructure.Tokens, token)
+			}
+		}
+	case opAddChirpVersion:
+		// Versions are appended in order, a replayed one is already there.
+		versions := dbStructure.History[entry.ChirpVersion.ChirpId]
+		if len(versions) < entry.ChirpVersion.Version {
+			dbStructure.History[entry.ChirpVersion.ChirpId] = append(versions, *entry.ChirpVersion)
+		}
+	case opPutChirpVersion:
+		versions := dbStructure.History[entry.ChirpVersion.ChirpId]
+		if entry.ChirpVersion.Version <= len(versions) {
+			versions[entry.ChirpVersion.Version-1] = *entry.ChirpVersion
+		}
+	case opPutLike:
+		likes, ok := dbStructure.Likes[entry.Like.ChirpId]
+		if !ok {
+			likes = make(map[int]time.Time)
+			dbStructure.Likes[entry.Like.ChirpId] = likes
+		}
+		likes[entry.Like.UserId] = entry.Like.CreatedAt
+		addToSet(dbStructure.likesByUser, entry.Like.UserId, entry.Like.ChirpId)
+	case opDeleteLike:
+		likes := dbStructure.Likes[entry.Like.ChirpId]
+		delete(likes, entry.Like.UserId)
+		if len(likes) == 0 {
+			delete(dbStructure.Likes, entry.Like.ChirpId)
+		}
+		removeFromSet(dbStructure.likesByUser, entry.Like.UserId, entry.Like.ChirpId)
+	case opPutFollow:
+		follows, ok := dbStructure.Follows[entry.Follow.FollowerId]
+		if !ok {
+			follows = make(map[int]time.Time)
+			dbStructure.Follows[entry.Follow.FollowerId] = follows
+		}
+		follows[entry.Follow.FolloweeId] = entry.Follow.CreatedAt
+		addToSet(dbStructure.followersOf, entry.Follow.FolloweeId, entry.Follow.FollowerId)
+	case opDeleteFollow:
+		follows := dbStructure.Follows[entry.Follow.FollowerId]
+		delete(follows, entry.Follow.FolloweeId)
+		if len(follows) == 0 {
+			delete(dbStructure.Follows, entry.Follow.FollowerId)
+		}
+		removeFromSet(dbStructure.followersOf, entry.Follow.FolloweeId, entry.Follow.FollowerId)
+	case opPutBannedWord:
+		dbStructure.BannedWords[entry.BannedWord.Word] = *entry.BannedWord
+	case opDeleteBannedWord:
+		delete(dbStructure.BannedWords, entry.BannedWord.Word)
+	case opPutReport:
+		dbStructure.Reports[entry.Report.Id] = *entry.Report
+		dbStructure.advanceSequence(sequenceReports, entry.Report.Id)
+	case opPutBlock:
+		putPair(dbStructure.Blocks, entry.Block.BlockerId, entry.Block.BlockedId, entry.Block.CreatedAt)
+	case opDeleteBlock:
+		deletePair(dbStructure.Blocks, entry.Block.BlockerId, entry.Block.BlockedId)
+	case opPutMute:
+		putPair(dbStructure.Mutes, entry.Mute.MuterId, entry.Mute.MutedId, entry.Mute.CreatedAt)
+	case opDeleteMute:
+		deletePair(dbStructure.Mutes, entry.Mute.MuterId, entry.Mute.MutedId)
+	default:
+		return errors.New("Unknown journal operation " + entry.Op + "!")
+	}
+	return nil
+}
+
+// undoFor returns a function that reverts what applying entry is
+// about to do to dbStructure, it must be called before the entry
+// is applied
+func (dbStructure *DBStructure) undoFor(entry journalEntry) func() {
+	sequences := make(map[string]int, len(dbStructure.Sequences))
+	for table, last := range dbStructure.Sequences {
+		sequences[table] = last
+	}
+	restoreSequences := func() {
+		dbStructure.Sequences = sequences
+	}
+	switch entry.Op {
+	case opPutChirp, opDeleteChirp:
+		id := entry.Id
+		if entry.Chirp != nil {
+			id = entry.Chirp.Id
+		}
+		old, existed := dbStructure.Chirps[id]
+		history, hadHistory := dbStructure.History[id]
+		likes := dbStructure.Likes[id]
+		return func() {
+			if current, ok := dbStructure.Chirps[id]; ok {
+				dbStructure.unindexChirp(current)
+				delete(dbStructure.Chirps, id)
+			}
+			if existed {
+				dbStructure.Chirps[id] = old
+				dbStructure.indexChirp(old)
+			}
+			if hadHistory {
+				dbStructure.History[id] = history
+			}
+			// Deleting a chirp drops the map rather than emptying it.
+			if len(likes) > 0 {
+				dbStructure.Likes[id] = likes
+				for userId := range likes {
+					addToSet(dbStructure.likesByUser, userId, id)
+				}
+			}
+			restoreSequences()
+		}
+	case opPutUser:
+		old, existed := dbStructure.Users[entry.User.Id]
+		return func() {
+			if current, ok := dbStructure.Users[entry.User.Id]; ok {
+				dbStructure.unindexUser(current)
+				delete(dbStructure.Users, entry.User.Id)
+			}
+			if existed {
+				dbStructure.Users[entry.User.Id] = old
+				dbStructure.indexUser(old)
+			}
+			restoreSequences()
+		}
+	case opRevokeToken:
+		old, existed := dbStructure.Tokens[entry.Token]
+		return func() {
+			delete(dbStructure.Tokens, entry.Token)
+			if existed {
+				dbStructure.Tokens[entry.Token] = old
+			}
+		}
+	case opAddChirpVersion, opPutChirpVersion:
+		chirpId := entry.ChirpVersion.ChirpId
+		history, hadHistory := dbStructure.History[chirpId]
+		// Putting a version changes it in place.
+		history = append([]ChirpVersion(nil), history...)
+		return func() {
+			delete(dbStructure.History, chirpId)
+			if hadHistory {
+				dbStructure.History[chirpId] = history
+			}
+		}
+	case opPutLike, opDeleteLike:
+		like := *entry.Like
+		likedAt, existed := dbStructure.Likes[like.ChirpId][like.UserId]
+		return func() {
+			undo := deleteLikeEntry(like)
+			if existed {
+				undo = putLikeEntry(Like{UserId: like.UserId, ChirpId: like.ChirpId, CreatedAt: likedAt})
+			}
+			undo.apply(dbStructure)
+		}
+	case opPutFollow, opDeleteFollow:
+		follow := *entry.Follow
+		followedAt, existed := dbStructure.Follows[follow.FollowerId][follow.FolloweeId]
+		return func() {
+			undo := deleteFollowEntry(follow)
+			if existed {
+				undo = putFollowEntry(Follow{FollowerId: follow.FollowerId, FolloweeId: follow.FolloweeId, CreatedAt: followedAt})
+			}
+			undo.apply(dbStructure)
+		}
+	case opPutBannedWord, opDeleteBannedWord:
+		word := entry.BannedWord.Word
+		old, existed := dbStructure.BannedWords[word]
+		return func() {
+			delete(dbStructure.BannedWords, word)
+			if existed {
+				dbStructure.BannedWords[word] = old
+			}
+		}
+	case opPutBlock, opDeleteBlock:
+		block := *entry.Block
+		blockedAt, existed := dbStructure.Blocks[block.BlockerId][block.BlockedId]
+		return func() {
+			undo := deleteBlockEntry(block)
+			if existed {
+				undo = putBlockEntry(Block{BlockerId: block.BlockerId, BlockedId: block.BlockedId, CreatedAt: blockedAt})
+			}
+			undo.apply(dbStructure)
+		}
+	case opPutMute, opDeleteMute:
+		mute := *entry.Mute
+		mutedAt, existed := dbStructure.Mutes[mute.MuterId][mute.MutedId]
+		return func() {
+			undo := deleteMuteEntry(mute)
+			if existed {
+				undo = putMuteEntry(Mute{MuterId: mute.MuterId, MutedId: mute.MutedId, CreatedAt: mutedAt})
+			}
+			undo.apply(dbStructure)
+		}
+	case opPutReport:
+		old, existed := dbStructure.Reports[entry.Report.Id]
+		return func() {
+			delete(dbStructure.Reports, entry.Report.Id)
+			if existed {
+				dbStructure.Reports[entry.Report.Id] = old
+			}
+			restoreSequences()
+		}
+	case opPruneTokens:
+		pruned := make(map[string]RevokedToken)
+		for token, revokedToken := range dbStructure.Tokens {
+			if revokedToken.ExpiresAt.Before(entry.Time) {
+				pruned[token] = revokedToken
+			}
+		}
+		return func() {
+			for token, revokedToken := range pruned {
+				dbStructure.Tokens[token] = revokedToken
+			}
+		}
+	}
+	return func() {}
+}
+
+func (db *DB) journalPath() string {
+	return db.path + ".journal"
+}
+
+// appendJournal writes entries to the journal and syncs it. If that
+// fails the journal is cut back to where it was, so entries whose
+// commit failed are never replayed.
+func (db *DB) appendJournal(entries []journalEntry) error {
+	file, err := os.OpenFile(db.journalPath(), os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0666)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+	info, err := file.Stat()
+	if err != nil {
+		return err
+	}
+	var buf bytes.Buffer
+	encoder := json.NewEncoder(&buf)
+	for _, entry := range entries {
+		err = encoder.Encode(entry)
+		if err != nil {
+			return err
+		}
+	}
+	_, err = file.Write(buf.Bytes())
+	if err == nil {
+		err = file.Sync()
+	}
+	if err != nil {
+		file.Truncate(info.Size())
+		return err
+	}
+	return nil
+}
+
+// truncateJournal empties the journal once a snapshot containing
+// all of its entries has been written
+func (db *DB) truncateJournal() error {
+	err := os.Truncate(db.journalPath(), 0)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil
+	}
+	return err
+}
+
+// readJournal returns the entries in the journal. A torn last line
+// is dropped since the mutation it belongs to never reported success.
+func (db *DB) readJournal() ([]journalEntry, error) {
+	file, err := os.Open(db.journalPath())
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+	var entries []journalEntry
+	scanner := bufio.NewScanner(file)
+	scanner.Buffer(make([]byte, 64*1024), 16*1024*1024)
+	for scanner.Scan() {
+		var entry journalEntry
+		err = json.Unmarshal(scanner.Bytes(), &entry)
+		if err != nil {
+			log.Printf("Dropping torn journal entry: %s", err)
+			break
+		}
+		entries = append(entries, entry)
+	}
+	return entries, scanner.Err()
+}
+
+// replayJournal applies any entries left in the journal to the
+// in-memory data, writes a fresh snapshot and empties the journal
+func (db *DB) replayJournal() error {
+	entries, err := db.readJournal()
+	if err != nil || len(entries) == 0 {
+		return err
+	}
+	for _, entry := range entries {
+		err = entry.apply(&db.data)
+		if err != nil {
+			return err
+		}
+	}
+	log.Printf("Replayed %d journal entries into %s", len(entries), db.path)
+	err = db.writeDB(db.data)
+	if err != nil {
+		return err
+	}
+	return db.truncateJournal()
+}
+
+// writeFileAtomic writes data to a temporary file next to path, syncs it
+// and renames it over path, so readers see either the old or the new file
+func writeFileAtomic(path string, data []byte, perm os.FileMode) error {
+	dir := filepath.Dir(path)
+	tmp, err := os.CreateTemp(dir, filepath.Base(path)+".tmp-*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+	_, err = tmp.Write(data)
+	if err != nil {
+		tmp.Close()
+		return err
+	}
+	err = tmp.Sync()
+	if err != nil {
+		tmp.Close()
+		return err
+	}
+	err = tmp.Close()
+	if err != nil {
+		return err
+	}
+	err = os.Chmod(tmp.Name(), perm)
+	if err != nil {
+		return err
+	}
+	err = os.Rename(tmp.Name(), path)
+	if err != nil {
+		return err
+	}
+	return syncDir(dir)
+}
+
+// syncDir syncs a directory so renames into it survive a crash
+func syncDir(dir string) error {
+	dirFile, err := os.Open(dir)
+	if err != nil {
+		return err
+	}
+	defer dirFile.Close()
+	return dirFile.Sync()
+}
@@ -0,0 +1,150 @@
+package database
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestReplayJournal(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "database.json")
+	db, err := NewDB(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	db.journal = true
+	_, err = db.CreateChirp("kept in the snapshot", "1")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Simulate a crash after the journal was synced but before
+	// the snapshot was renamed into place.
+	lost := Chirp{Id: 2, Body: "only in the journal", AuthorId: 1}
+	err = db.appendJournal([]journalEntry{
+		putChirpEntry(lost),
+		revokeTokenEntry("some.jwt", RevokedToken{RevokedAt: time.Now(), ExpiresAt: time.Now().Add(time.Hour)}),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	file, err := os.OpenFile(db.journalPath(), os.O_APPEND|os.O_WRONLY, 0666)
+	if err != nil {
+		t.Fatal(err)
+	}
+	file.WriteString(`{"op":"put_chi`)
+	file.Close()
+
+	db, err = NewDB(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	chirp, err := db.GetChirp(2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(chirp, lost) {
+		t.Fatalf("got %+v, want %+v", chirp, lost)
+	}
+	if db.CheckRevocation("some.jwt") == nil {
+		t.Fatal("revocation from the journal was not replayed")
+	}
+	info, err := os.Stat(db.journalPath())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if info.Size() != 0 {
+		t.Fatalf("journal not truncated after replay, %d bytes left", info.Size())
+	}
+}
+
+func TestWriteFileAtomicLeavesNoTempFiles(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "database.json")
+	for i := 0; i < 3; i++ {
+		err := writeFileAtomic(path, []byte("{}"), 0666)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(entries) != 1 {
+		t.Fatalf("expected only database.json, found %d files", len(entries))
+	}
+}
+
+// breakWrites makes writing the file at path fail by putting a
+// directory in its place, returning how to undo it
+func breakWrites(t *testing.T, path string) func() {
+	t.Helper()
+	err := os.Rename(path, path+".saved")
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = os.MkdirAll(filepath.Join(path, "blocker"), 0777)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return func() {
+		err := os.RemoveAll(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		err = os.Rename(path+".saved", path)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+func TestFailedWrite(t *testing.T) {
+	for _, journal := range []bool{false, true} {
+		path := filepath.Join(t.TempDir(), "database.json")
+		db, err := NewDB(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		db.journal = journal
+		_, err = db.CreateChirp("written", "1")
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		restore := breakWrites(t, path)
+		_, err = db.CreateChirp("write fails", "1")
+		restore()
+		if journal {
+			// The journal holds the chirp, so it is committed.
+			if err != nil {
+				t.Fatalf("journaled create: got %v, want it committed", err)
+			}
+		} else if err == nil {
+			t.Fatal("created a chirp that was never written")
+		}
+		_, err = db.GetChirp(2)
+		if journal != (err == nil) {
+			t.Fatalf("journal %v: chirp 2 in memory after the failed write: %v", journal, err)
+		}
+
+		db, err = NewDB(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		chirps, err := db.GetChirps()
+		if err != nil {
+			t.Fatal(err)
+		}
+		want := 1
+		if journal {
+			want = 2
+		}
+		if len(chirps) != want {
+			t.Fatalf("journal %v: got %+v after reopening, want %d chirps", journal, chirps, want)
+		}
+	}
+}
@@ -0,0 +1,156 @@
+package database
+
+import (
+	"errors"
+	"time"
+)
+
+// Like records that a user liked a chirp, a user likes a chirp at most once
+type Like struct {
+	UserId    int       `json:"user_id"`
+	ChirpId   int       `json:"chirp_id"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// ChirpLikes is how many likes a chirp has and whether
+// the user looking at it is one of them
+type ChirpLikes struct {
+	LikeCount int  `json:"like_count"`
+	LikedByMe bool `json:"liked_by_me"`
+}
+
+// LikeChirp makes userId like a chirp, liking it again changes
+// nothing. Chirps userId may not see are not found.
+func (s txStore) LikeChirp(userId int, chirpId int) (ChirpLikes, error) {
+	var likes ChirpLikes
+	err := s.backend.Update(func(tx Tx) error {
+		chirp, err := tx.GetChirp(chirpId)
+		if err != nil {
+			return err
+		}
+		ok, err := canSee(tx, chirp, userId)
+		if err != nil {
+			return err
+		}
+		if !ok {
+			return ErrNotFound
+		}
+		err = checkBlocked(tx, userId, chirp.AuthorId)
+		if err != nil {
+			return err
+		}
+		_, err = tx.GetLike(userId, chirpId)
+		if errors.Is(err, ErrNotFound) {
+			err = tx.PutLike(Like{UserId: userId, ChirpId: chirpId, CreatedAt: time.Now().UTC()})
+		}
+		if err != nil {
+			return err
+		}
+		likes, err = chirpLikes(tx, chirpId, userId)
+		return err
+	})
+	return likes, err
+}
+
+// UnlikeChirp takes back the like of userId, if there is one
+func (s txStore) UnlikeChirp(userId int, chirpId int) (ChirpLikes, error) {
+	var likes ChirpLikes
+	err := s.backend.Update(func(tx Tx) error {
+		_, err := tx.GetChirp(chirpId)
+		if err != nil {
+			return err
+		}
+		_, err = tx.GetLike(userId, chirpId)
+		if err == nil {
+			err = tx.DeleteLike(userId, chirpId)
+		} else if errors.Is(err, ErrNotFound) {
+			err = nil
+		}
+		if err != nil {
+			return err
+		}
+		likes, err = chirpLikes(tx, chirpId, userId)
+		return err
+	})
+	return likes, err
+}
+
+// chirpLikes returns the likes of a single chirp as seen by userId
+func chirpLikes(tx Tx, chirpId int, userId int) (ChirpLikes, error) {
+	likes, err := getChirpLikes(tx, []int{chirpId}, userId)
+	if err != nil {
+		return ChirpLikes{}, err
+	}
+	return likes[chirpId], nil
+}
+
+// GetChirpLikes returns the likes of each of chirpIds as seen
+// by userId, which is 0 for someone who isn't logged in
+func (s txStore) GetChirpLikes(chirpIds []int, userId int) (map[int]ChirpLikes, error) {
+	var likes map[int]ChirpLikes
+	err := s.backend.View(func(tx Tx) error {
+		var err error
+		likes, err = getChirpLikes(tx, chirpIds, userId)
+		return err
+	})
+	return likes, err
+}
+
+func getChirpLikes(tx Tx, chirpIds []int, userId int) (map[int]ChirpLikes, error) {
+	counts, err := tx.CountLikes(chirpIds)
+	if err != nil {
+		return nil, err
+	}
+	likes := make(map[int]ChirpLikes, len(chirpIds))
+	for _, chirpId := range chirpIds {
+		chirpLikes := ChirpLikes{LikeCount: counts[chirpId]}
+		if userId != 0 && chirpLikes.LikeCount > 0 {
+			_, err = tx.GetLike(userId, chirpId)
+			if err == nil {
+				chirpLikes.LikedByMe = true
+			} else if !errors.Is(err, ErrNotFound) {
+				return nil, err
+			}
+		}
+		likes[chirpId] = chirpLikes
+	}
+	return likes, nil
+}
+
+// GetLikedChirps returns the chirps a user liked that viewerId
+// may see, most recently liked first. Likes of chirps hidden by the
+// moderators are kept in case they come back, but left out.
+func (s txStore) GetLikedChirps(userId int, viewerId int) ([]Chirp, error) {
+	chirps := []Chirp{}
+	err := s.backend.View(func(tx Tx) error {
+		_, err := tx.GetUser(userId)
+		if err != nil {
+			return err
+		}
+		likes, err := tx.GetLikesByUser(userId)
+		if err != nil {
+			return err
+		}
+		for _, like := range likes {
+			chirp, err := tx.GetChirp(like.ChirpId)
+			if errors.Is(err, ErrNotFound) {
+				continue
+			}
+			if err != nil {
+				return err
+			}
+			ok, err := canSee(tx, chirp, viewerId)
+			if err != nil {
+				return err
+			}
+			if ok {
+				chirps = append(chirps, chirp)
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return chirps, nil
+}
@@ -0,0 +1,92 @@
+package database
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestLikes(t *testing.T) {
+	for name, db := range openStores(t) {
+		t.Run(name, func(t *testing.T) {
+			for _, email := range []string{"walt@example.com", "jesse@example.com"} {
+				_, err := db.CreateUser(email, "hash")
+				if err != nil {
+					t.Fatal(err)
+				}
+			}
+			for i := 0; i < 2; i++ {
+				_, err := db.CreateChirp("hello", "1")
+				if err != nil {
+					t.Fatal(err)
+				}
+			}
+
+			_, err := db.LikeChirp(1, 42)
+			if !errors.Is(err, ErrNotFound) {
+				t.Fatalf("liking a missing chirp: got %v, want ErrNotFound", err)
+			}
+			for i := 0; i < 2; i++ {
+				likes, err := db.LikeChirp(1, 1)
+				if err != nil {
+					t.Fatal(err)
+				}
+				if likes != (ChirpLikes{LikeCount: 1, LikedByMe: true}) {
+					t.Fatalf("got %+v after liking chirp 1, want one like by me", likes)
+				}
+			}
+			_, err = db.LikeChirp(2, 1)
+			if err != nil {
+				t.Fatal(err)
+			}
+			_, err = db.LikeChirp(1, 2)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			likes, err := db.GetChirpLikes([]int{1, 2}, 2)
+			if err != nil {
+				t.Fatal(err)
+			}
+			want := map[int]ChirpLikes{1: {LikeCount: 2, LikedByMe: true}, 2: {LikeCount: 1}}
+			for chirpId, chirpLikes := range want {
+				if likes[chirpId] != chirpLikes {
+					t.Fatalf("got %+v for chirp %d, want %+v", likes[chirpId], chirpId, chirpLikes)
+				}
+			}
+
+			liked, err := db.GetLikedChirps(1, 0)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(liked) != 2 || liked[0].Id != 2 || liked[1].Id != 1 {
+				t.Fatalf("got %+v, want chirps 2 and 1", liked)
+			}
+			_, err = db.GetLikedChirps(42, 0)
+			if !errors.Is(err, ErrNotFound) {
+				t.Fatalf("likes of a missing user: got %v, want ErrNotFound", err)
+			}
+
+			likesOfOne, err := db.UnlikeChirp(1, 1)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if likesOfOne != (ChirpLikes{LikeCount: 1}) {
+				t.Fatalf("got %+v after unliking chirp 1, want one like by someone else", likesOfOne)
+			}
+			_, err = db.UnlikeChirp(1, 1)
+			if err != nil {
+				t.Fatalf("unliking twice: %v", err)
+			}
+
+			// Likes go with their chirp.
+			err = db.DeleteChirp("2")
+			if err != nil {
+				t.Fatal(err)
+			}
+			liked, err = db.GetLikedChirps(1, 0)
+			if err != nil || len(liked) != 0 {
+				t.Fatalf("got %+v, %v, want no liked chirps", liked, err)
+			}
+		})
+	}
+}
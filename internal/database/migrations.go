@@ -0,0 +1,647 @@
+package database
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"time"
+)
+
+// migration upgrades a database by one schema version. Each backend
+// gets its own step, they must leave both in the same logical shape.
+type migration struct {
+	description string
+	json        func(dbStructure *DBStructure) error
+	sqlite      func(tx *sql.Tx) error
+}
+
+// migrations is the ordered list of schema changes, a database at
+// version n has had the first n applied. Only ever append to it.
+var migrations = []migration{
+	{
+		description: "initial schema",
+		json: func(dbStructure *DBStructure) error {
+			return nil
+		},
+		sqlite: func(tx *sql.Tx) error {
+			_, err := tx.Exec(sqliteSchema)
+			return err
+		},
+	},
+	{
+		description: "record when revoked tokens expire",
+		json: func(dbStructure *DBStructure) error {
+			for token, revokedToken := range dbStructure.Tokens {
+				if revokedToken.ExpiresAt.IsZero() {
+					revokedToken.ExpiresAt = revokedToken.RevokedAt.Add(legacyTokenLifetime)
+					dbStructure.Tokens[token] = revokedToken
+				}
+			}
+			return nil
+		},
+		sqlite: func(tx *sql.Tx) error {
+			_, err := tx.Exec("ALTER TABLE tokens ADD COLUMN expires_at TIMESTAMP")
+			if err != nil {
+				return err
+			}
+			_, err = tx.Exec("CREATE INDEX tokens_expires_at ON tokens (expires_at)")
+			if err != nil {
+				return err
+			}
+			rows, err := tx.Query("SELECT token, revoked_at FROM tokens")
+			if err != nil {
+				return err
+			}
+			revokedAt := make(map[string]time.Time)
+			for rows.Next() {
+				var token string
+				var at time.Time
+				err = rows.Scan(&token, &at)
+				if err != nil {
+					rows.Close()
+					return err
+				}
+				revokedAt[token] = at
+			}
+			rows.Close()
+			if rows.Err() != nil {
+				return rows.Err()
+			}
+			for token, at := range revokedAt {
+				_, err = tx.Exec("UPDATE tokens SET expires_at = ? WHERE token = ?", at.Add(legacyTokenLifetime).UTC(), token)
+				if err != nil {
+					return err
+				}
+			}
+			return nil
+		},
+	},
+	{
+		description: "index chirps by author and users by email",
+		json: func(dbStructure *DBStructure) error {
+			// The JSON store builds its indexes in memory on load.
+			return nil
+		},
+		sqlite: func(tx *sql.Tx) error {
+			_, err := tx.Exec("CREATE INDEX chirps_author_id ON chirps (author_id, id)")
+			if err != nil {
+				return err
+			}
+			_, err = tx.Exec("ALTER TABLE users ADD COLUMN email_lower TEXT")
+			if err != nil {
+				return err
+			}
+			// SQLite's lower() only folds ASCII, normalize in Go instead.
+			rows, err := tx.Query("SELECT id, email FROM users")
+			if err != nil {
+				return err
+			}
+			emails := make(map[int]string)
+			for rows.Next() {
+				var id int
+				var email string
+				err = rows.Scan(&id, &email)
+				if err != nil {
+					rows.Close()
+					return err
+				}
+				emails[id] = email
+			}
+			rows.Close()
+			if rows.Err() != nil {
+				return rows.Err()
+			}
+			for id, email := range emails {
+				_, err = tx.Exec("UPDATE users SET email_lower = ? WHERE id = ?", normalizeEmail(email), id)
+				if err != nil {
+					return err
+				}
+			}
+			_, err = tx.Exec("CREATE UNIQUE INDEX users_email_lower ON users (email_lower)")
+			return err
+		},
+	},
+	{
+		description: "allocate ids from sequences and add opaque uids",
+		json: func(dbStructure *DBStructure) error {
+			for id := range dbStructure.Chirps {
+				dbStructure.advanceSequence(sequenceChirps, id)
+			}
+			for id := range dbStructure.Users {
+				dbStructure.advanceSequence(sequenceUsers, id)
+			}
+			return nil
+		},
+		sqlite: func(tx *sql.Tx) error {
+			// Ids of rows deleted before this migration can't be known,
+			// the sequences start from the highest id still around.
+			_, err := tx.Exec(`
+CREATE TABLE sequences (
+	name  TEXT    PRIMARY KEY,
+	value INTEGER NOT NULL
+);
+INSERT INTO sequences (name, value) SELECT 'chirps', coalesce(max(id), 0) FROM chirps;
+INSERT INTO sequences (name, value) SELECT 'users', coalesce(max(id), 0) FROM users;
+ALTER TABLE chirps ADD COLUMN uid TEXT NOT NULL DEFAULT '';
+ALTER TABLE users ADD COLUMN uid TEXT NOT NULL DEFAULT '';
+CREATE UNIQUE INDEX chirps_uid ON chirps (uid) WHERE uid != '';
+CREATE UNIQUE INDEX users_uid ON users (uid) WHERE uid != '';
+`)
+			return err
+		},
+	},
+	{
+		description: "record when chirps and users are created and updated",
+		json: func(dbStructure *DBStructure) error {
+			// Missing timestamps read as the zero time.
+			return nil
+		},
+		sqlite: func(tx *sql.Tx) error {
+			_, err := tx.Exec(`
+ALTER TABLE chirps ADD COLUMN created_at TIMESTAMP NOT NULL DEFAULT '0001-01-01 00:00:00+00:00';
+ALTER TABLE chirps ADD COLUMN updated_at TIMESTAMP NOT NULL DEFAULT '0001-01-01 00:00:00+00:00';
+ALTER TABLE users ADD COLUMN created_at TIMESTAMP NOT NULL DEFAULT '0001-01-01 00:00:00+00:00';
+ALTER TABLE users ADD COLUMN updated_at TIMESTAMP NOT NULL DEFAULT '0001-01-01 00:00:00+00:00';
+CREATE INDEX chirps_created_at ON chirps (created_at, id);
+CREATE INDEX chirps_author_id_created_at ON chirps (author_id, created_at, id);
+`)
+			return err
+		},
+	},
+	{
+		description: "keep earlier versions of edited chirps",
+		json: func(dbStructure *DBStructure) error {
+			// An empty history is created on load.
+			return nil
+		},
+		sqlite: func(tx *sql.Tx) error {
+			_, err := tx.Exec(`
+CREATE TABLE chirp_versions (
+	chirp_id   INTEGER   NOT NULL,
+	version    INTEGER   NOT NULL,
+	body       TEXT      NOT NULL,
+	created_at TIMESTAMP NOT NULL,
+	PRIMARY KEY (chirp_id, version)
+);
+`)
+			return err
+		},
+	},
+	{
+		description: "let chirps reply to each other and leave tombstones",
+		json: func(dbStructure *DBStructure) error {
+			// Chirps without in_reply_to start threads of their own.
+			return nil
+		},
+		sqlite: func(tx *sql.Tx) error {
+			_, err := tx.Exec(`
+ALTER TABLE chirps ADD COLUMN in_reply_to INTEGER NOT NULL DEFAULT 0;
+ALTER TABLE chirps ADD COLUMN deleted INTEGER NOT NULL DEFAULT 0;
+CREATE INDEX chirps_in_reply_to ON chirps (in_reply_to, created_at, id);
+`)
+			return err
+		},
+	},
+	{
+		description: "let users like chirps",
+		json: func(dbStructure *DBStructure) error {
+			// An empty set of likes is created on load.
+			return nil
+		},
+		sqlite: func(tx *sql.Tx) error {
+			_, err := tx.Exec(`
+CREATE TABLE likes (
+	user_id    INTEGER   NOT NULL,
+	chirp_id   INTEGER   NOT NULL,
+	created_at TIMESTAMP NOT NULL,
+	PRIMARY KEY (user_id, chirp_id)
+);
+CREATE INDEX likes_chirp_id ON likes (chirp_id);
+CREATE INDEX likes_user_id_created_at ON likes (user_id, created_at, chirp_id);
+`)
+			return err
+		},
+	},
+	{
+		description: "let chirps rechirp and quote each other",
+		json: func(dbStructure *DBStructure) error {
+			// Chirps without ref_chirp_id reshare nothing.
+			return nil
+		},
+		sqlite: func(tx *sql.Tx) error {
+			_, err := tx.Exec(`
+ALTER TABLE chirps ADD COLUMN ref_chirp_id INTEGER NOT NULL DEFAULT 0;
+ALTER TABLE chirps ADD COLUMN ref_kind TEXT NOT NULL DEFAULT '';
+CREATE INDEX chirps_ref_chirp_id ON chirps (ref_chirp_id, created_at, id);
+`)
+			return err
+		},
+	},
+	{
+		description: "let users follow each other",
+		json: func(dbStructure *DBStructure) error {
+			// An empty follow graph is created on load.
+			return nil
+		},
+		sqlite: func(tx *sql.Tx) error {
+			_, err := tx.Exec(`
+CREATE TABLE follows (
+	follower_id INTEGER   NOT NULL,
+	followee_id INTEGER   NOT NULL,
+	created_at  TIMESTAMP NOT NULL,
+	PRIMARY KEY (follower_id, followee_id)
+);
+CREATE INDEX follows_followee_id ON follows (followee_id, created_at);
+`)
+			return err
+		},
+	},
+	{
+		description: "find hashtags and mentions in chirps",
+		json: func(dbStructure *DBStructure) error {
+			for id, chirp := range dbStructure.Chirps {
+				if chirp.Deleted {
+					continue
+				}
+				var err error
+				chirp.Entities, err = resolveEntities(chirp.Body, func(email string) (int, error) {
+					userId, ok := dbStructure.userIdsByEmail[normalizeEmail(email)]
+					if !ok {
+						return 0, ErrNotFound
+					}
+					return userId, nil
+				})
+				if err != nil {
+					return err
+				}
+				dbStructure.Chirps[id] = chirp
+			}
+			dbStructure.buildIndexes()
+			return nil
+		},
+		sqlite: func(tx *sql.Tx) error {
+			_, err := tx.Exec(`
+ALTER TABLE chirps ADD COLUMN entities TEXT NOT NULL DEFAULT '[]';
+CREATE TABLE hashtags (
+	tag      TEXT    NOT NULL,
+	chirp_id INTEGER NOT NULL,
+	PRIMARY KEY (tag, chirp_id)
+);
+CREATE INDEX hashtags_chirp_id ON hashtags (chirp_id);
+CREATE TABLE mentions (
+	user_id  INTEGER NOT NULL,
+	chirp_id INTEGER NOT NULL,
+	PRIMARY KEY (user_id, chirp_id)
+);
+CREATE INDEX mentions_chirp_id ON mentions (chirp_id);
+`)
+			if err != nil {
+				return err
+			}
+			rows, err := tx.Query("SELECT id, body FROM chirps WHERE deleted = 0")
+			if err != nil {
+				return err
+			}
+			bodies := make(map[int]string)
+			for rows.Next() {
+				var id int
+				var body string
+				err = rows.Scan(&id, &body)
+				if err != nil {
+					rows.Close()
+					return err
+				}
+				bodies[id] = body
+			}
+			rows.Close()
+			if rows.Err() != nil {
+				return rows.Err()
+			}
+			for id, body := range bodies {
+				entities, err := resolveEntities(body, func(email string) (int, error) {
+					var userId int
+					err := tx.QueryRow("SELECT id FROM users WHERE email_lower = ?", normalizeEmail(email)).Scan(&userId)
+					if errors.Is(err, sql.ErrNoRows) {
+						return 0, ErrNotFound
+					}
+					return userId, err
+				})
+				if err != nil {
+					return err
+				}
+				chirp := Chirp{Id: id, Entities: entities}
+				_, err = tx.Exec("UPDATE chirps SET entities = ? WHERE id = ?", entities, id)
+				if err != nil {
+					return err
+				}
+				for _, tag := range chirp.hashtags() {
+					_, err = tx.Exec("INSERT INTO hashtags (tag, chirp_id) VALUES (?, ?)", tag, id)
+					if err != nil {
+						return err
+					}
+				}
+				for _, userId := range chirp.mentions() {
+					_, err = tx.Exec("INSERT INTO mentions (user_id, chirp_id) VALUES (?, ?)", userId, id)
+					if err != nil {
+						return err
+					}
+				}
+			}
+			return nil
+		},
+	},
+	{
+		description: "index the words of chirps for search",
+		json: func(dbStructure *DBStructure) error {
+			// The search index is built on load.
+			return nil
+		},
+		sqlite: func(tx *sql.Tx) error {
+			_, err := tx.Exec(`
+CREATE TABLE search_terms (
+	term      TEXT    NOT NULL,
+	chirp_id  INTEGER NOT NULL,
+	positions TEXT    NOT NULL,
+	frequency INTEGER NOT NULL,
+	PRIMARY KEY (term, chirp_id)
+);
+CREATE INDEX search_terms_chirp_id ON search_terms (chirp_id);
+`)
+			if err != nil {
+				return err
+			}
+			_, err = (&sqliteTx{tx: tx, writable: true}).rebuildSearchIndex("SELECT id, body FROM chirps WHERE deleted = 0")
+			return err
+		},
+	},
+	{
+		description: "keep the profanity list in the database",
+		json: func(dbStructure *DBStructure) error {
+			// Start from the list that used to be built in.
+			for _, bannedWord := range seedBannedWords(time.Now().UTC()) {
+				dbStructure.BannedWords[bannedWord.Word] = bannedWord
+			}
+			return nil
+		},
+		sqlite: func(tx *sql.Tx) error {
+			_, err := tx.Exec(`
+CREATE TABLE banned_words (
+	word       TEXT      PRIMARY KEY,
+	action     TEXT      NOT NULL,
+	created_at TIMESTAMP NOT NULL
+);
+`)
+			if err != nil {
+				return err
+			}
+			for _, bannedWord := range seedBannedWords(time.Now().UTC()) {
+				_, err = tx.Exec("INSERT INTO banned_words (word, action, created_at) VALUES (?, ?, ?)",
+					bannedWord.Word, bannedWord.Action, bannedWord.CreatedAt)
+				if err != nil {
+					return err
+				}
+			}
+			return nil
+		},
+	},
+	{
+		description: "let users report chirps and moderators hide them",
+		json: func(dbStructure *DBStructure) error {
+			// An empty set of reports is created on load.
+			return nil
+		},
+		sqlite: func(tx *sql.Tx) error {
+			_, err := tx.Exec(`
+ALTER TABLE chirps ADD COLUMN hidden INTEGER NOT NULL DEFAULT 0;
+CREATE TABLE reports (
+	id          INTEGER   PRIMARY KEY,
+	chirp_id    INTEGER   NOT NULL,
+	reporter_id INTEGER   NOT NULL,
+	reason      TEXT      NOT NULL,
+	status      TEXT      NOT NULL,
+	note        TEXT      NOT NULL,
+	created_at  TIMESTAMP NOT NULL,
+	resolved_at TIMESTAMP
+);
+CREATE INDEX reports_chirp_id ON reports (chirp_id);
+CREATE INDEX reports_reporter_id ON reports (reporter_id, created_at);
+CREATE INDEX reports_status ON reports (status, created_at);
+INSERT INTO sequences (name, value) VALUES ('reports', 0);
+`)
+			return err
+		},
+	},
+	{
+		description: "let users block and mute each other",
+		json: func(dbStructure *DBStructure) error {
+			// Empty blocks and mutes are created on load.
+			return nil
+		},
+		sqlite: func(tx *sql.Tx) error {
+			_, err := tx.Exec(`
+CREATE TABLE blocks (
+	blocker_id INTEGER   NOT NULL,
+	blocked_id INTEGER   NOT NULL,
+	created_at TIMESTAMP NOT NULL,
+	PRIMARY KEY (blocker_id, blocked_id)
+);
+CREATE TABLE mutes (
+	muter_id   INTEGER   NOT NULL,
+	muted_id   INTEGER   NOT NULL,
+	created_at TIMESTAMP NOT NULL,
+	PRIMARY KEY (muter_id, muted_id)
+);
+`)
+			return err
+		},
+	},
+	{
+		description: "let authors choose who sees their chirps",
+		json: func(dbStructure *DBStructure) error {
+			for id, chirp := range dbStructure.Chirps {
+				if chirp.Deleted {
+					continue
+				}
+				chirp.Visibility = VisibilityPublic
+				dbStructure.Chirps[id] = chirp
+			}
+			return nil
+		},
+		sqlite: func(tx *sql.Tx) error {
+			_, err := tx.Exec(`
+ALTER TABLE chirps ADD COLUMN visibility TEXT NOT NULL DEFAULT 'public';
+UPDATE chirps SET visibility = '' WHERE deleted = 1;
+`)
+			return err
+		},
+	},
+	{
+		description: "stop keeping the emails of mentioned users in entities",
+		json: func(dbStructure *DBStructure) error {
+			for id, chirp := range dbStructure.Chirps {
+				chirp.Entities = chirp.Entities.withoutEmails()
+				dbStructure.Chirps[id] = chirp
+			}
+			return nil
+		},
+		sqlite: func(tx *sql.Tx) error {
+			rows, err := tx.Query("SELECT id, entities FROM chirps WHERE entities LIKE '%\"mention\"%'")
+			if err != nil {
+				return err
+			}
+			found := make(map[int]Entities)
+			for rows.Next() {
+				var id int
+				var entities Entities
+				err = rows.Scan(&id, &entities)
+				if err != nil {
+					rows.Close()
+					return err
+				}
+				found[id] = entities
+			}
+			rows.Close()
+			if rows.Err() != nil {
+				return rows.Err()
+			}
+			for id, entities := range found {
+				_, err = tx.Exec("UPDATE chirps SET entities = ? WHERE id = ?", entities.withoutEmails(), id)
+				if err != nil {
+					return err
+				}
+			}
+			return nil
+		},
+	},
+}
+
+// SchemaVersion is the schema version this build reads and writes
+func SchemaVersion() int {
+	return len(migrations)
+}
+
+// checkVersion refuses to work with a database from another schema version
+func checkVersion(path string, version int) error {
+	if version < SchemaVersion() {
+		return fmt.Errorf("Database %s is at schema version %d but %d is needed, run the migrate command first!", path, version, SchemaVersion())
+	}
+	if version > SchemaVersion() {
+		return fmt.Errorf("Database %s is at schema version %d, newer than the %d this build understands!", path, version, SchemaVersion())
+	}
+	return nil
+}
+
+// backupPath names the copy of path taken before migrating it away from version
+func backupPath(path string, version int) string {
+	return fmt.Sprintf("%s.v%d-%s.bak", path, version, time.Now().Format("20060102T150405"))
+}
+
+// Migrate upgrades the database described by cfg in place to
+// SchemaVersion, after copying it to a backup file next to it.
+// It returns the version the database was at and the backup path,
+// which is empty if there was nothing to do.
+func Migrate(cfg Config) (int, string, error) {
+	switch cfg.Driver {
+	case "", "json":
+		db, err := openDB(cfg.Path)
+		if err != nil {
+			return 0, "", err
+		}
+		return db.migrate()
+	case "sqlite":
+		db, err := openSQLiteDB(cfg.Path)
+		if err != nil {
+			return 0, "", err
+		}
+		defer db.Close()
+		return db.migrate()
+	}
+	return 0, "", fmt.Errorf("Unknown database driver %q!", cfg.Driver)
+}
+
+func (db *DB) migrate() (int, string, error) {
+	db.mux.Lock()
+	defer db.mux.Unlock()
+	from := db.data.Version
+	if from >= SchemaVersion() {
+		return from, "", checkVersion(db.path, from)
+	}
+	databaseBytes, err := os.ReadFile(db.path)
+	if err != nil {
+		return from, "", err
+	}
+	backup := backupPath(db.path, from)
+	err = writeFileAtomic(backup, databaseBytes, 0666)
+	if err != nil {
+		return from, "", err
+	}
+	// Migrate a copy so a failing step leaves nothing half-done.
+	dbStructure := db.data.copy()
+	for version := from; version < SchemaVersion(); version++ {
+		log.Printf("Migrating %s to version %d: %s", db.path, version+1, migrations[version].description)
+		err = migrations[version].json(&dbStructure)
+		if err != nil {
+			return from, backup, err
+		}
+		dbStructure.Version = version + 1
+	}
+	err = db.writeDB(dbStructure)
+	if err != nil {
+		return from, backup, err
+	}
+	db.data = dbStructure
+	return from, backup, nil
+}
+
+func (s *SQLiteDB) version() (int, error) {
+	var version int
+	err := s.db.QueryRow("PRAGMA user_version").Scan(&version)
+	return version, err
+}
+
+// isEmpty reports whether the database has no tables yet
+func (s *SQLiteDB) isEmpty() (bool, error) {
+	var tables int
+	err := s.db.QueryRow("SELECT count(*) FROM sqlite_master WHERE type = 'table'").Scan(&tables)
+	return tables == 0, err
+}
+
+// applyMigrations runs every migration after from, each in its own
+// transaction together with the bump of user_version
+func (s *SQLiteDB) applyMigrations(from int) error {
+	for version := from; version < SchemaVersion(); version++ {
+		err := s.update(func(tx *sql.Tx) error {
+			err := migrations[version].sqlite(tx)
+			if err != nil {
+				return err
+			}
+			_, err = tx.Exec(fmt.Sprintf("PRAGMA user_version = %d", version+1))
+			return err
+		})
+		if err != nil {
+			return fmt.Errorf("Migration to version %d failed: %w", version+1, err)
+		}
+	}
+	return nil
+}
+
+func (s *SQLiteDB) migrate() (int, string, error) {
+	from, err := s.version()
+	if err != nil {
+		return 0, "", err
+	}
+	if from >= SchemaVersion() {
+		return from, "", checkVersion(s.path, from)
+	}
+	backup := backupPath(s.path, from)
+	_, err = s.db.Exec("VACUUM INTO ?", backup)
+	if err != nil {
+		return from, "", err
+	}
+	for version := from; version < SchemaVersion(); version++ {
+		log.Printf("Migrating %s to version %d: %s", s.path, version+1, migrations[version].description)
+	}
+	return from, backup, s.applyMigrations(from)
+}
@@ -0,0 +1,183 @@
+package database
+
+import (
+	"database/sql"
+	"fmt"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestMigrateJSON(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "database.json")
+	legacy := `{"chirps":{"1":{"id":1,"body":"old","author_id":1},"2":{"id":2,"body":"#golang","author_id":1}},"users":{},"tokens":{"some.jwt":"2024-01-01T00:00:00Z"}}`
+	err := os.WriteFile(path, []byte(legacy), 0666)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = NewDB(path)
+	if err == nil {
+		t.Fatal("opened a database with an outdated schema")
+	}
+
+	from, backup, err := Migrate(Config{Driver: "json", Path: path})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if from != 0 {
+		t.Fatalf("migrated from version %d, want 0", from)
+	}
+	backupBytes, err := os.ReadFile(backup)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(backupBytes) != legacy {
+		t.Fatalf("backup doesn't match the original file: %s", backupBytes)
+	}
+
+	db, err := NewDB(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	chirp, err := db.GetChirp(1)
+	if err != nil || chirp.Body != "old" {
+		t.Fatalf("chirp lost in migration: %+v, %v", chirp, err)
+	}
+	if chirp.Visibility != VisibilityPublic {
+		t.Fatalf("got visibility %q for a legacy chirp, want public", chirp.Visibility)
+	}
+	tagged, err := db.QueryChirps(ChirpQuery{Hashtag: "golang"})
+	if err != nil || len(tagged) != 1 || tagged[0].Id != 2 {
+		t.Fatalf("got %+v, %v, want the legacy chirp tagged", tagged, err)
+	}
+	words, err := db.GetBannedWords()
+	if err != nil || len(words) != len(defaultBannedWords) {
+		t.Fatalf("got %+v, %v, want the built in profanity list", words, err)
+	}
+	dbStructure, _ := db.LoadDB()
+	wantExpiry := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC).Add(legacyTokenLifetime)
+	if !dbStructure.Tokens["some.jwt"].ExpiresAt.Equal(wantExpiry) {
+		t.Fatalf("legacy revocation expires at %s, want %s", dbStructure.Tokens["some.jwt"].ExpiresAt, wantExpiry)
+	}
+
+	_, backup, err = Migrate(Config{Driver: "json", Path: path})
+	if err != nil || backup != "" {
+		t.Fatalf("migrating an up to date database should do nothing, got %q, %v", backup, err)
+	}
+}
+
+func TestMigrateSQLite(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "database.sqlite")
+	legacy, err := sql.Open("sqlite3", path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = legacy.Exec(sqliteSchema)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = legacy.Exec("INSERT INTO chirps (body, author_id) VALUES ('old', 1), ('#golang', 1)")
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = legacy.Exec("INSERT INTO tokens (token, revoked_at) VALUES ('some.jwt', ?)", time.Now().Add(-legacyTokenLifetime-time.Hour))
+	if err != nil {
+		t.Fatal(err)
+	}
+	legacy.Close()
+
+	_, err = NewSQLiteDB(path)
+	if err == nil {
+		t.Fatal("opened a database with an outdated schema")
+	}
+	_, backup, err := Migrate(Config{Driver: "sqlite", Path: path})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := os.Stat(backup); err != nil {
+		t.Fatalf("no backup taken: %s", err)
+	}
+	db, err := NewSQLiteDB(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	chirp, err := db.GetChirp(1)
+	if err != nil || chirp.Body != "old" {
+		t.Fatalf("chirp lost in migration: %+v, %v", chirp, err)
+	}
+	if chirp.Visibility != VisibilityPublic {
+		t.Fatalf("got visibility %q for a legacy chirp, want public", chirp.Visibility)
+	}
+	tagged, err := db.QueryChirps(ChirpQuery{Hashtag: "golang"})
+	if err != nil || len(tagged) != 1 || tagged[0].Id != 2 {
+		t.Fatalf("got %+v, %v, want the legacy chirp tagged", tagged, err)
+	}
+	words, err := db.GetBannedWords()
+	if err != nil || len(words) != len(defaultBannedWords) {
+		t.Fatalf("got %+v, %v, want the built in profanity list", words, err)
+	}
+	pruned, err := db.PruneRevokedTokens(time.Now())
+	if err != nil || pruned != 1 {
+		t.Fatalf("legacy revocation not given an expiry: pruned %d, %v", pruned, err)
+	}
+}
+
+func TestMigrateMentionEmails(t *testing.T) {
+	withEmail := Entities{{Kind: EntityMention, Text: "walt@example.com", Start: 3, End: 20, UserId: 1}}
+	want := Entities{{Kind: EntityMention, Start: 3, End: 20, UserId: 1}}
+
+	path := filepath.Join(t.TempDir(), "database.json")
+	legacy := fmt.Sprintf(`{"version":%d,"chirps":{"1":{"id":1,"body":"hi @walt@example.com","author_id":1,"visibility":"public",`+
+		`"entities":[{"kind":"mention","text":"walt@example.com","start":3,"end":20,"user_id":1}]}}}`, SchemaVersion()-1)
+	err := os.WriteFile(path, []byte(legacy), 0666)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, _, err = Migrate(Config{Driver: "json", Path: path})
+	if err != nil {
+		t.Fatal(err)
+	}
+	db, err := NewDB(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	chirp, err := db.GetChirp(1)
+	if err != nil || !reflect.DeepEqual(chirp.Entities, want) {
+		t.Fatalf("got %+v, %v, want entities %+v", chirp.Entities, err, want)
+	}
+
+	path = filepath.Join(t.TempDir(), "database.sqlite")
+	sqliteDB, err := NewSQLiteDB(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = sqliteDB.CreateChirp("hi @walt@example.com", "1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = sqliteDB.db.Exec("UPDATE chirps SET entities = ? WHERE id = 1", withEmail)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = sqliteDB.db.Exec(fmt.Sprintf("PRAGMA user_version = %d", SchemaVersion()-1))
+	if err != nil {
+		t.Fatal(err)
+	}
+	sqliteDB.Close()
+	_, _, err = Migrate(Config{Driver: "sqlite", Path: path})
+	if err != nil {
+		t.Fatal(err)
+	}
+	sqliteDB, err = NewSQLiteDB(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer sqliteDB.Close()
+	chirp, err = sqliteDB.GetChirp(1)
+	if err != nil || !reflect.DeepEqual(chirp.Entities, want) {
+		t.Fatalf("got %+v, %v, want entities %+v", chirp.Entities, err, want)
+	}
+}
@@ -0,0 +1,85 @@
+package database
+
+import "time"
+
+// ChirpQuery selects and orders chirps for QueryChirps. Chirps are
+// ordered by creation time, ties broken by id. Paging is keyed on
+// both, so pages stay stable while chirps are created.
+type ChirpQuery struct {
+	// AuthorId only keeps chirps by this author, 0 keeps all
+	AuthorId int
+	// AuthorIds only keeps chirps by one of these authors, nil keeps all
+	AuthorIds []int
+	// Hashtag only keeps chirps tagged with it, whatever its case
+	Hashtag string
+	// MentionOf only keeps chirps mentioning this user, 0 keeps all
+	MentionOf int
+	// MutedBy leaves out the chirps of the users this user muted,
+	// 0 leaves out none
+	MutedBy int
+	// ViewerId only keeps the chirps this user may see, 0 standing
+	// for someone who isn't logged in, who only sees public chirps
+	ViewerId int
+	// Since and Until only keep chirps created at or after Since and
+	// before Until, the zero time leaves that end open
+	Since time.Time
+	Until time.Time
+	// Desc orders newest first instead of oldest first
+	Desc bool
+	// After only keeps chirps that come after this one in the chosen
+	// order, only its CreatedAt and Id matter. The zero Chirp starts
+	// from the beginning.
+	After Chirp
+	// Limit caps the number of chirps returned, 0 returns all
+	Limit int
+}
+
+// before reports whether a comes before b in the order of query
+func (query ChirpQuery) before(a, b Chirp) bool {
+	if query.Desc {
+		a, b = b, a
+	}
+	if !a.CreatedAt.Equal(b.CreatedAt) {
+		return a.CreatedAt.Before(b.CreatedAt)
+	}
+	return a.Id < b.Id
+}
+
+// matches reports whether query selects chirp, ignoring
+// MutedBy, ViewerId and Limit
+func (query ChirpQuery) matches(chirp Chirp) bool {
+	if !chirp.listed() {
+		return false
+	}
+	if query.AuthorId != 0 && chirp.AuthorId != query.AuthorId {
+		return false
+	}
+	if query.AuthorIds != nil && !containsId(query.AuthorIds, chirp.AuthorId) {
+		return false
+	}
+	if query.Hashtag != "" && !containsString(chirp.hashtags(), normalizeHashtag(query.Hashtag)) {
+		return false
+	}
+	if query.MentionOf != 0 && !containsId(chirp.mentions(), query.MentionOf) {
+		return false
+	}
+	if !query.Since.IsZero() && chirp.CreatedAt.Before(query.Since) {
+		return false
+	}
+	if !query.Until.IsZero() && !chirp.CreatedAt.Before(query.Until) {
+		return false
+	}
+	if query.After.Id != 0 && !query.before(query.After, chirp) {
+		return false
+	}
+	return true
+}
+
+func containsId(ids []int, id int) bool {
+	for _, candidate := range ids {
+		if candidate == id {
+			return true
+		}
+	}
+	return false
+}
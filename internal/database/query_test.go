@@ -0,0 +1,57 @@
+package database
+
+import (
+	"testing"
+	"time"
+)
+
+func TestQueryChirps(t *testing.T) {
+	for name, db := range openStores(t) {
+		t.Run(name, func(t *testing.T) {
+			byId := make(map[int]Chirp)
+			for _, authorId := range []string{"1", "2", "1", "1", "2"} {
+				chirp, err := db.CreateChirp("by "+authorId, authorId)
+				if err != nil {
+					t.Fatal(err)
+				}
+				byId[chirp.Id] = chirp
+				// Keep creation times apart for the since and until cases.
+				time.Sleep(time.Millisecond)
+			}
+			tests := []struct {
+				query ChirpQuery
+				want  []int
+			}{
+				{ChirpQuery{}, []int{1, 2, 3, 4, 5}},
+				{ChirpQuery{Limit: 2}, []int{1, 2}},
+				{ChirpQuery{After: byId[2], Limit: 2}, []int{3, 4}},
+				{ChirpQuery{Desc: true, Limit: 2}, []int{5, 4}},
+				{ChirpQuery{Desc: true, After: byId[4]}, []int{3, 2, 1}},
+				{ChirpQuery{AuthorId: 1, After: byId[1]}, []int{3, 4}},
+				{ChirpQuery{AuthorId: 2, Desc: true, Limit: 1}, []int{5}},
+				{ChirpQuery{After: byId[5]}, []int{}},
+				{ChirpQuery{Since: byId[2].CreatedAt, Until: byId[4].CreatedAt}, []int{2, 3}},
+				{ChirpQuery{Since: byId[4].CreatedAt, Desc: true}, []int{5, 4}},
+				{ChirpQuery{Until: byId[1].CreatedAt}, []int{}},
+			}
+			for _, test := range tests {
+				chirps, err := db.QueryChirps(test.query)
+				if err != nil {
+					t.Fatal(err)
+				}
+				got := make([]int, len(chirps))
+				for i, chirp := range chirps {
+					got[i] = chirp.Id
+				}
+				if len(got) != len(test.want) {
+					t.Fatalf("%+v: got ids %v, want %v", test.query, got, test.want)
+				}
+				for i := range got {
+					if got[i] != test.want[i] {
+						t.Fatalf("%+v: got ids %v, want %v", test.query, got, test.want)
+					}
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,70 @@
+package database
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestRechirps(t *testing.T) {
+	for name, db := range openStores(t) {
+		t.Run(name, func(t *testing.T) {
+			original, err := db.CreateChirp("hello", "1")
+			if err != nil {
+				t.Fatal(err)
+			}
+			rechirp, err := db.PostChirp(Chirp{Body: "ignored", AuthorId: 2, RefChirpId: original.Id, RefKind: RefRechirp})
+			if err != nil {
+				t.Fatal(err)
+			}
+			if rechirp.Body != "" || rechirp.RefChirpId != original.Id {
+				t.Fatalf("got %+v, want a plain rechirp of chirp %d", rechirp, original.Id)
+			}
+			_, err = db.PostChirp(Chirp{AuthorId: 2, RefChirpId: original.Id, RefKind: RefRechirp})
+			if !errors.Is(err, ErrRechirped) {
+				t.Fatalf("rechirping twice: got %v, want ErrRechirped", err)
+			}
+			_, err = db.EditChirp(rechirp.Id, 2, "hello")
+			if !errors.Is(err, ErrForbidden) {
+				t.Fatalf("editing a plain rechirp: got %v, want ErrForbidden", err)
+			}
+			quote, err := db.PostChirp(Chirp{Body: "so true", AuthorId: 3, RefChirpId: rechirp.Id, RefKind: RefQuote})
+			if err != nil {
+				t.Fatal(err)
+			}
+			if quote.RefChirpId != original.Id {
+				t.Fatalf("quoting a rechirp quoted chirp %d, want the original %d", quote.RefChirpId, original.Id)
+			}
+
+			// Plain rechirps go with the original, quotes keep a tombstone of it.
+			err = db.DeleteChirp("1")
+			if err != nil {
+				t.Fatal(err)
+			}
+			_, err = db.GetChirp(rechirp.Id)
+			if !errors.Is(err, ErrNotFound) {
+				t.Fatalf("got %v, want the plain rechirp deleted", err)
+			}
+			refChirps, err := db.GetRefChirps([]Chirp{quote}, 0)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if refChirp := refChirps[original.Id]; !refChirp.Deleted || refChirp.Body != "" {
+				t.Fatalf("got %+v, want a tombstone of the quoted chirp", refChirp)
+			}
+			_, err = db.PostChirp(Chirp{Body: "me too", AuthorId: 3, RefChirpId: original.Id, RefKind: RefQuote})
+			if !errors.Is(err, ErrNotFound) {
+				t.Fatalf("quoting a tombstone: got %v, want ErrNotFound", err)
+			}
+
+			// The tombstone goes with the last quote.
+			err = db.DeleteChirp("3")
+			if err != nil {
+				t.Fatal(err)
+			}
+			_, err = db.GetThread(original.Id, 0)
+			if !errors.Is(err, ErrNotFound) {
+				t.Fatalf("got %v, want the tombstone cleared away", err)
+			}
+		})
+	}
+}
@@ -0,0 +1,175 @@
+package database
+
+import (
+	"errors"
+	"sort"
+	"time"
+)
+
+// Statuses of a Report. A report is open until a moderator decides
+// on it, the other statuses record the decision.
+const (
+	ReportOpen      = "open"
+	ReportDismissed = "dismissed"
+	ReportHidden    = "hidden"
+	ReportDeleted   = "deleted"
+)
+
+// Report asks the moderators to look at a chirp. Reports filed by the
+// profanity filter have no ReporterId. Reports outlive their chirp, so
+// reporters still learn what was decided once it is deleted.
+type Report struct {
+	Id         int        `json:"id"`
+	ChirpId    int        `json:"chirp_id"`
+	ReporterId int        `json:"reporter_id,omitempty"`
+	Reason     string     `json:"reason"`
+	Status     string     `json:"status"`
+	Note       string     `json:"note,omitempty"`
+	CreatedAt  time.Time  `json:"created_at"`
+	ResolvedAt *time.Time `json:"resolved_at,omitempty"`
+}
+
+// sortReports orders reports oldest first
+func sortReports(reports []Report) {
+	sort.Slice(reports, func(i, j int) bool {
+		if !reports[i].CreatedAt.Equal(reports[j].CreatedAt) {
+			return reports[i].CreatedAt.Before(reports[j].CreatedAt)
+		}
+		return reports[i].Id < reports[j].Id
+	})
+}
+
+// ReportChirp files report on the chirp it names. Reporters can't
+// report a chirp again while their report on it is open, nor report
+// chirps they may not see.
+func (s txStore) ReportChirp(report Report) (Report, error) {
+	err := s.backend.Update(func(tx Tx) error {
+		chirp, err := tx.GetChirp(report.ChirpId)
+		if err != nil {
+			return err
+		}
+		if report.ReporterId != 0 {
+			ok, err := canSee(tx, chirp, report.ReporterId)
+			if err != nil {
+				return err
+			}
+			if !ok {
+				return ErrNotFound
+			}
+		}
+		reports, err := tx.GetReportsOf(report.ChirpId)
+		if err != nil {
+			return err
+		}
+		for _, other := range reports {
+			if other.ReporterId == report.ReporterId && other.Status == ReportOpen {
+				return ErrReported
+			}
+		}
+		report.Status = ReportOpen
+		report.CreatedAt = time.Now().UTC()
+		report, err = tx.InsertReport(report)
+		return err
+	})
+	if err != nil {
+		return Report{}, err
+	}
+	return report, nil
+}
+
+// GetReport returns a single report
+func (s txStore) GetReport(id int) (Report, error) {
+	var report Report
+	err := s.backend.View(func(tx Tx) error {
+		var err error
+		report, err = tx.GetReport(id)
+		return err
+	})
+	return report, err
+}
+
+// GetReports returns the reports with status, or all of them
+// for "", oldest first
+func (s txStore) GetReports(status string) ([]Report, error) {
+	var reports []Report
+	err := s.backend.View(func(tx Tx) error {
+		var err error
+		reports, err = tx.GetReportsByStatus(status)
+		return err
+	})
+	return reports, err
+}
+
+// GetReportsBy returns the reports a user filed, newest first
+func (s txStore) GetReportsBy(reporterId int) ([]Report, error) {
+	var reports []Report
+	err := s.backend.View(func(tx Tx) error {
+		var err error
+		reports, err = tx.GetReportsBy(reporterId)
+		return err
+	})
+	return reports, err
+}
+
+// ResolveReport records the decision on an open report, status being
+// ReportDismissed, ReportHidden or ReportDeleted, and carries it out on
+// the chirp. The decision is about the chirp, so every open report on
+// it is resolved the same way.
+func (s txStore) ResolveReport(id int, status string, note string) (Report, error) {
+	var resolved Report
+	err := s.backend.Update(func(tx Tx) error {
+		report, err := tx.GetReport(id)
+		if err != nil {
+			return err
+		}
+		if report.Status != ReportOpen {
+			return ErrResolved
+		}
+		switch status {
+		case ReportHidden:
+			chirp, err := tx.GetChirp(report.ChirpId)
+			// There is nothing left to hide of a deleted chirp.
+			if errors.Is(err, ErrNotFound) {
+				break
+			}
+			if err != nil {
+				return err
+			}
+			chirp.Hidden = true
+			err = tx.PutChirp(chirp)
+			if err != nil {
+				return err
+			}
+		case ReportDeleted:
+			err = deleteChirp(tx, report.ChirpId)
+			if err != nil {
+				return err
+			}
+		}
+		reports, err := tx.GetReportsOf(report.ChirpId)
+		if err != nil {
+			return err
+		}
+		resolvedAt := time.Now().UTC()
+		for _, other := range reports {
+			if other.Status != ReportOpen {
+				continue
+			}
+			other.Status = status
+			other.Note = note
+			other.ResolvedAt = &resolvedAt
+			err = tx.PutReport(other)
+			if err != nil {
+				return err
+			}
+			if other.Id == id {
+				resolved = other
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return Report{}, err
+	}
+	return resolved, nil
+}
@@ -0,0 +1,131 @@
+package database
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestReports(t *testing.T) {
+	for name, db := range openStores(t) {
+		t.Run(name, func(t *testing.T) {
+			root, err := db.CreateChirp("Say my name", "1")
+			if err != nil {
+				t.Fatal(err)
+			}
+			reply, err := db.PostChirp(Chirp{Body: "Heisenberg", AuthorId: 2, InReplyTo: root.Id})
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			_, err = db.ReportChirp(Report{ChirpId: 42, ReporterId: 3, Reason: "spam"})
+			if !errors.Is(err, ErrNotFound) {
+				t.Fatalf("reporting a missing chirp: got %v, want ErrNotFound", err)
+			}
+			first, err := db.ReportChirp(Report{ChirpId: reply.Id, ReporterId: 3, Reason: "spam"})
+			if err != nil || first.Status != ReportOpen || first.Id == 0 {
+				t.Fatalf("got %+v, %v", first, err)
+			}
+			_, err = db.ReportChirp(Report{ChirpId: reply.Id, ReporterId: 3, Reason: "still spam"})
+			if !errors.Is(err, ErrReported) {
+				t.Fatalf("got %v, want ErrReported", err)
+			}
+			second, err := db.ReportChirp(Report{ChirpId: reply.Id, Reason: "flagged words: heisenberg"})
+			if err != nil {
+				t.Fatal(err)
+			}
+			other, err := db.ReportChirp(Report{ChirpId: root.Id, ReporterId: 3, Reason: "rude"})
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			open, err := db.GetReports(ReportOpen)
+			if err != nil || len(open) != 3 || open[0].Id != first.Id {
+				t.Fatalf("got %+v, %v, want 3 open reports oldest first", open, err)
+			}
+
+			hidden, err := db.ResolveReport(first.Id, ReportHidden, "Not nice")
+			if err != nil || hidden.Status != ReportHidden || hidden.Note != "Not nice" || hidden.ResolvedAt == nil {
+				t.Fatalf("got %+v, %v", hidden, err)
+			}
+			_, err = db.ResolveReport(second.Id, ReportDismissed, "")
+			if !errors.Is(err, ErrResolved) {
+				t.Fatalf("got %v, want the other report on the chirp resolved too", err)
+			}
+			_, err = db.GetChirp(reply.Id)
+			if !errors.Is(err, ErrNotFound) {
+				t.Fatalf("got %v, want the hidden chirp gone", err)
+			}
+			thread, err := db.GetThread(root.Id, 0)
+			if err != nil || len(thread) != 2 || !thread[1].Hidden || thread[1].Body != "" {
+				t.Fatalf("got %+v, %v, want the hidden reply as a placeholder", thread, err)
+			}
+
+			_, err = db.ResolveReport(other.Id, ReportDeleted, "")
+			if err != nil {
+				t.Fatal(err)
+			}
+			_, err = db.GetChirp(root.Id)
+			if !errors.Is(err, ErrNotFound) {
+				t.Fatalf("got %v, want the chirp deleted", err)
+			}
+
+			mine, err := db.GetReportsBy(3)
+			if err != nil || len(mine) != 2 || mine[0].Id != other.Id || mine[0].Status != ReportDeleted || mine[1].Status != ReportHidden {
+				t.Fatalf("got %+v, %v, want both decisions, newest first", mine, err)
+			}
+			open, err = db.GetReports(ReportOpen)
+			if err != nil || len(open) != 0 {
+				t.Fatalf("got %+v, %v, want no open reports", open, err)
+			}
+			all, err := db.GetReports("")
+			if err != nil || len(all) != 3 {
+				t.Fatalf("got %+v, %v, want every report", all, err)
+			}
+		})
+	}
+}
+
+func TestHiddenChirpLikes(t *testing.T) {
+	for name, db := range openStores(t) {
+		t.Run(name, func(t *testing.T) {
+			user, err := db.CreateUser("jesse@example.com", "hash")
+			if err != nil {
+				t.Fatal(err)
+			}
+			kept, err := db.CreateChirp("Yeah science", "2")
+			if err != nil {
+				t.Fatal(err)
+			}
+			hidden, err := db.CreateChirp("Yeah mr white", "2")
+			if err != nil {
+				t.Fatal(err)
+			}
+			for _, chirp := range []Chirp{kept, hidden} {
+				_, err = db.LikeChirp(user.Id, chirp.Id)
+				if err != nil {
+					t.Fatal(err)
+				}
+			}
+			report, err := db.ReportChirp(Report{ChirpId: hidden.Id, ReporterId: 3, Reason: "spam"})
+			if err != nil {
+				t.Fatal(err)
+			}
+			_, err = db.ResolveReport(report.Id, ReportHidden, "")
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			liked, err := db.GetLikedChirps(user.Id, 0)
+			if err != nil || len(liked) != 1 || liked[0].Id != kept.Id {
+				t.Fatalf("got %+v, %v, want only the chirp still shown", liked, err)
+			}
+			likes, err := db.GetChirpLikes([]int{kept.Id, hidden.Id}, user.Id)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if likes[kept.Id] != (ChirpLikes{LikeCount: 1, LikedByMe: true}) || likes[hidden.Id] != (ChirpLikes{}) {
+				t.Fatalf("got likes %+v, want none counted for the hidden chirp", likes)
+			}
+		})
+	}
+}
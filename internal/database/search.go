@@ -0,0 +1,186 @@
+package database
+
+import (
+	"math"
+	"sort"
+	"strings"
+	"unicode"
+)
+
+// SearchQuery selects chirps for SearchChirps
+type SearchQuery struct {
+	// Text holds the words to search for, all of which must be in a
+	// chirp. Words in double quotes must also be next to each other
+	// in that order.
+	Text string
+	// AuthorId only keeps chirps by this author, 0 keeps all
+	AuthorId int
+	// ViewerId only keeps the chirps this user may see, 0 standing
+	// for someone who isn't logged in
+	ViewerId int
+	// Limit caps the number of chirps returned, 0 returns all
+	Limit int
+}
+
+// BM25 parameters, the usual ones
+const (
+	bm25K1 = 1.2
+	bm25B  = 0.75
+)
+
+// tokenize splits text into the lowercased words the search index holds
+func tokenize(text string) []string {
+	return strings.FieldsFunc(strings.ToLower(text), func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r) && !unicode.IsMark(r)
+	})
+}
+
+// termPositions returns where each word of body is, counted in words
+func termPositions(body string) map[string][]int {
+	positions := make(map[string][]int)
+	for i, term := range tokenize(body) {
+		positions[term] = append(positions[term], i)
+	}
+	return positions
+}
+
+// parseSearch returns the distinct words of a search text and its
+// quoted phrases of more than one word. An unclosed quote runs to
+// the end of the text.
+func parseSearch(text string) ([]string, [][]string) {
+	var terms []string
+	var phrases [][]string
+	for i, part := range strings.Split(text, `"`) {
+		tokens := tokenize(part)
+		for _, token := range tokens {
+			if !containsString(terms, token) {
+				terms = append(terms, token)
+			}
+		}
+		if i%2 == 1 && len(tokens) > 1 {
+			phrases = append(phrases, tokens)
+		}
+	}
+	return terms, phrases
+}
+
+// containsPhrase reports whether the words of phrase
+// follow each other in the chirp whose postings are given
+func containsPhrase(phrase []string, positions map[string][]int) bool {
+	for _, start := range positions[phrase[0]] {
+		found := true
+		for offset, term := range phrase[1:] {
+			if !containsId(positions[term], start+offset+1) {
+				found = false
+				break
+			}
+		}
+		if found {
+			return true
+		}
+	}
+	return false
+}
+
+// SearchChirps returns the chirps matching query, the most relevant
+// first as ranked by BM25, ties going to the newest
+func (s txStore) SearchChirps(query SearchQuery) ([]Chirp, error) {
+	terms, phrases := parseSearch(query.Text)
+	chirps := []Chirp{}
+	if len(terms) == 0 {
+		return chirps, nil
+	}
+	scores := make(map[int]float64)
+	err := s.backend.View(func(tx Tx) error {
+		docs, tokens, err := tx.SearchStats()
+		if err != nil {
+			return err
+		}
+		// postings[term][chirpId] are the positions of term in the chirp
+		postings := make(map[string]map[int][]int, len(terms))
+		for _, term := range terms {
+			postings[term], err = tx.SearchTerm(term)
+			if err != nil {
+				return err
+			}
+		}
+		// Any chirp with every term is in the postings of the first.
+		for chirpId := range postings[terms[0]] {
+			positions := make(map[string][]int, len(terms))
+			for _, term := range terms {
+				positions[term] = postings[term][chirpId]
+			}
+			if !matchesAll(terms, phrases, positions) {
+				continue
+			}
+			chirp, err := tx.GetChirp(chirpId)
+			if err != nil {
+				return err
+			}
+			if query.AuthorId != 0 && chirp.AuthorId != query.AuthorId {
+				continue
+			}
+			ok, err := canSee(tx, chirp, query.ViewerId)
+			if err != nil {
+				return err
+			}
+			if !ok {
+				continue
+			}
+			length := float64(len(tokenize(chirp.Body)))
+			averageLength := float64(tokens) / float64(docs)
+			score := 0.0
+			for _, term := range terms {
+				frequency := float64(len(positions[term]))
+				found := float64(len(postings[term]))
+				idf := math.Log(1 + (float64(docs)-found+0.5)/(found+0.5))
+				score += idf * frequency * (bm25K1 + 1) / (frequency + bm25K1*(1-bm25B+bm25B*length/averageLength))
+			}
+			scores[chirp.Id] = score
+			chirps = append(chirps, chirp)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	newestFirst := ChirpQuery{Desc: true}
+	sort.Slice(chirps, func(i, j int) bool {
+		if scores[chirps[i].Id] != scores[chirps[j].Id] {
+			return scores[chirps[i].Id] > scores[chirps[j].Id]
+		}
+		return newestFirst.before(chirps[i], chirps[j])
+	})
+	if query.Limit > 0 && len(chirps) > query.Limit {
+		chirps = chirps[:query.Limit]
+	}
+	return chirps, nil
+}
+
+// matchesAll reports whether a chirp with the given
+// positions has all of terms and phrases
+func matchesAll(terms []string, phrases [][]string, positions map[string][]int) bool {
+	for _, term := range terms {
+		if len(positions[term]) == 0 {
+			return false
+		}
+	}
+	for _, phrase := range phrases {
+		if !containsPhrase(phrase, positions) {
+			return false
+		}
+	}
+	return true
+}
+
+// RebuildSearchIndex indexes every chirp again from scratch
+// and returns how many chirps have words in the index
+func (s txStore) RebuildSearchIndex() (int, error) {
+	var indexed int
+	err := s.backend.Update(func(tx Tx) error {
+		var err error
+		indexed, err = tx.RebuildSearchIndex()
+		return err
+	})
+	return indexed, err
+}
@@ -0,0 +1,87 @@
+package database
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestParseSearch(t *testing.T) {
+	terms, phrases := parseSearch(`Blue "crystal Meth" blue "single"`)
+	if !reflect.DeepEqual(terms, []string{"blue", "crystal", "meth", "single"}) {
+		t.Fatalf("got terms %q", terms)
+	}
+	if !reflect.DeepEqual(phrases, [][]string{{"crystal", "meth"}}) {
+		t.Fatalf("got phrases %q", phrases)
+	}
+}
+
+func TestSearchChirps(t *testing.T) {
+	for name, db := range openStores(t) {
+		t.Run(name, func(t *testing.T) {
+			bodies := []struct {
+				body     string
+				authorId string
+			}{
+				{"Say my name", "1"},
+				{"My name is Walter, my name!", "1"},
+				{"Name my price", "2"},
+				{"Nothing to see here", "2"},
+			}
+			for _, chirp := range bodies {
+				_, err := db.CreateChirp(chirp.body, chirp.authorId)
+				if err != nil {
+					t.Fatal(err)
+				}
+			}
+			tests := []struct {
+				query SearchQuery
+				want  []int
+			}{
+				// Chirp 2 has both words twice.
+				{SearchQuery{Text: "name my"}, []int{2, 3, 1}},
+				{SearchQuery{Text: `"my name"`}, []int{2, 1}},
+				{SearchQuery{Text: `"name my"`}, []int{3}},
+				{SearchQuery{Text: "NAME", AuthorId: 2}, []int{3}},
+				{SearchQuery{Text: "name", Limit: 1}, []int{2}},
+				{SearchQuery{Text: "name walter jesse"}, []int{}},
+				{SearchQuery{Text: `""`}, []int{}},
+			}
+			for _, test := range tests {
+				chirps, err := db.SearchChirps(test.query)
+				if err != nil {
+					t.Fatal(err)
+				}
+				ids := []int{}
+				for _, chirp := range chirps {
+					ids = append(ids, chirp.Id)
+				}
+				if !equalIds(ids, test.want) {
+					t.Errorf("%+v: got %v, want %v", test.query, ids, test.want)
+				}
+			}
+
+			// The index follows edits and deletes.
+			_, err := db.EditChirp(1, 1, "Say when")
+			if err != nil {
+				t.Fatal(err)
+			}
+			err = db.DeleteChirp("2")
+			if err != nil {
+				t.Fatal(err)
+			}
+			chirps, err := db.SearchChirps(SearchQuery{Text: "name"})
+			if err != nil || len(chirps) != 1 || chirps[0].Id != 3 {
+				t.Fatalf("got %+v, %v, want chirp 3", chirps, err)
+			}
+
+			indexed, err := db.RebuildSearchIndex()
+			if err != nil || indexed != 3 {
+				t.Fatalf("rebuilt an index of %d chirps, %v, want 3", indexed, err)
+			}
+			chirps, err = db.SearchChirps(SearchQuery{Text: "say"})
+			if err != nil || len(chirps) != 1 || chirps[0].Id != 1 {
+				t.Fatalf("got %+v, %v after rebuilding, want chirp 1", chirps, err)
+			}
+		})
+	}
+}
@@ -0,0 +1,849 @@
+package database
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"strings"
+	"time"
+
+	_ "github.com/mattn/go-sqlite3"
+)
+
+// sqliteSchema is the version 1 schema, later changes are migrations
+const sqliteSchema = `
+CREATE TABLE IF NOT EXISTS chirps (
+	id        INTEGER PRIMARY KEY,
+	body      TEXT    NOT NULL,
+	author_id INTEGER NOT NULL
+);
+CREATE TABLE IF NOT EXISTS users (
+	id            INTEGER PRIMARY KEY,
+	email         TEXT    NOT NULL,
+	password      TEXT    NOT NULL,
+	is_chirpy_red INTEGER NOT NULL DEFAULT 0
+);
+CREATE TABLE IF NOT EXISTS tokens (
+	token      TEXT      PRIMARY KEY,
+	revoked_at TIMESTAMP NOT NULL
+);
+`
+
+// Columns selected for a chirp or a user, in the order they are scanned
+const (
+	chirpColumns = "id, uid, body, author_id, in_reply_to, ref_chirp_id, ref_kind, visibility, entities, deleted, hidden, created_at, updated_at"
+	userColumns  = "id, uid, email, password, is_chirpy_red, created_at, updated_at"
+)
+
+// SQLiteDB is a Store kept in a SQLite database file.
+type SQLiteDB struct {
+	txStore
+	path     string
+	idScheme string
+	db       *sql.DB
+}
+
+// NewSQLiteDB opens the SQLite database at path, creating the
+// tables in a new database and checking the schema version of
+// an existing one
+func NewSQLiteDB(path string) (*SQLiteDB, error) {
+	s, err := openSQLiteDB(path)
+	if err != nil {
+		return nil, err
+	}
+	empty, err := s.isEmpty()
+	if err != nil {
+		s.Close()
+		return nil, err
+	}
+	if empty {
+		err = s.applyMigrations(0)
+		if err != nil {
+			s.Close()
+			return nil, err
+		}
+	}
+	version, err := s.version()
+	if err != nil {
+		s.Close()
+		return nil, err
+	}
+	err = checkVersion(path, version)
+	if err != nil {
+		s.Close()
+		return nil, err
+	}
+	return s, nil
+}
+
+// openSQLiteDB opens the database at path without looking at its schema
+func openSQLiteDB(path string) (*SQLiteDB, error) {
+	db, err := sql.Open("sqlite3", path+"?_busy_timeout=5000&_journal_mode=WAL")
+	if err != nil {
+		return nil, err
+	}
+	// SQLite only allows a single writer anyway.
+	db.SetMaxOpenConns(1)
+	s := &SQLiteDB{path: path, db: db}
+	s.txStore = txStore{backend: s}
+	return s, nil
+}
+
+func (s *SQLiteDB) Close() error {
+	return s.db.Close()
+}
+
+// update runs fn inside a transaction and commits it if fn succeeds
+func (s *SQLiteDB) update(fn func(tx *sql.Tx) error) error {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return err
+	}
+	err = fn(tx)
+	if err != nil {
+		tx.Rollback()
+		return err
+	}
+	return tx.Commit()
+}
+
+// View runs fn inside a transaction that is always rolled back
+func (s *SQLiteDB) View(fn func(tx Tx) error) error {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+	return fn(&sqliteTx{s: s, tx: tx})
+}
+
+// Update runs fn inside a transaction that is committed if fn succeeds
+func (s *SQLiteDB) Update(fn func(tx Tx) error) error {
+	return s.update(func(tx *sql.Tx) error {
+		return fn(&sqliteTx{s: s, tx: tx, writable: true})
+	})
+}
+
+// sqliteTx is a Tx on top of a SQL transaction
+type sqliteTx struct {
+	s        *SQLiteDB
+	tx       *sql.Tx
+	writable bool
+}
+
+// exec runs a statement that modifies the database
+func (tx *sqliteTx) exec(query string, args ...interface{}) (sql.Result, error) {
+	if !tx.writable {
+		return nil, errReadOnly
+	}
+	return tx.tx.Exec(query, args...)
+}
+
+// nextId hands out the next id of table's sequence.
+// Unlike max(id)+1 this never reuses the id of a deleted row.
+func (tx *sqliteTx) nextId(table string) (int, error) {
+	if !tx.writable {
+		return 0, errReadOnly
+	}
+	var id int
+	err := tx.tx.QueryRow("UPDATE sequences SET value = value + 1 WHERE name = ? RETURNING value", table).Scan(&id)
+	return id, err
+}
+
+func (tx *sqliteTx) GetChirps() ([]Chirp, error) {
+	return tx.queryChirps("SELECT " + chirpColumns + " FROM chirps WHERE deleted = 0 AND hidden = 0 ORDER BY id")
+}
+
+func (tx *sqliteTx) GetChirpsByAuthor(authorId int) ([]Chirp, error) {
+	return tx.queryChirps("SELECT "+chirpColumns+" FROM chirps WHERE author_id = ? AND deleted = 0 AND hidden = 0 ORDER BY id", authorId)
+}
+
+func (tx *sqliteTx) QueryChirps(query ChirpQuery) ([]Chirp, error) {
+	where := []string{"deleted = 0 AND hidden = 0"}
+	args := []interface{}{}
+	if query.AuthorId != 0 {
+		where = append(where, "author_id = ?")
+		args = append(args, query.AuthorId)
+	}
+	if query.Hashtag != "" {
+		where = append(where, "id IN (SELECT chirp_id FROM hashtags WHERE tag = ?)")
+		args = append(args, normalizeHashtag(query.Hashtag))
+	}
+	if query.MentionOf != 0 {
+		where = append(where, "id IN (SELECT chirp_id FROM mentions WHERE user_id = ?)")
+		args = append(args, query.MentionOf)
+	}
+	where = append(where, "(visibility = 'public' OR author_id = ? OR (visibility = 'followers' AND author_id IN (SELECT followee_id FROM follows WHERE follower_id = ?)))")
+	args = append(args, query.ViewerId, query.ViewerId)
+	if query.MutedBy != 0 {
+		where = append(where, "author_id NOT IN (SELECT muted_id FROM mutes WHERE muter_id = ?)")
+		args = append(args, query.MutedBy)
+	}
+	if query.AuthorIds != nil {
+		if len(query.AuthorIds) == 0 {
+			return []Chirp{}, nil
+		}
+		placeholders, authorIds := inList(query.AuthorIds)
+		where = append(where, "author_id IN ("+placeholders+")")
+		args = append(args, authorIds...)
+	}
+	if !query.Since.IsZero() {
+		where = append(where, "created_at >= ?")
+		args = append(args, query.Since.UTC())
+	}
+	if !query.Until.IsZero() {
+		where = append(where, "created_at < ?")
+		args = append(args, query.Until.UTC())
+	}
+	if query.After.Id != 0 {
+		if query.Desc {
+			where = append(where, "(created_at, id) < (?, ?)")
+		} else {
+			where = append(where, "(created_at, id) > (?, ?)")
+		}
+		args = append(args, query.After.CreatedAt.UTC(), query.After.Id)
+	}
+	order := "created_at, id"
+	if query.Desc {
+		order = "created_at DESC, id DESC"
+	}
+	sqlQuery := "SELECT " + chirpColumns + " FROM chirps WHERE " + strings.Join(where, " AND ") + " ORDER BY " + order
+	if query.Limit > 0 {
+		sqlQuery += " LIMIT ?"
+		args = append(args, query.Limit)
+	}
+	return tx.queryChirps(sqlQuery, args...)
+}
+
+// inList returns the placeholders and arguments for an IN (...) of ids,
+// which mustn't be empty
+func inList(ids []int) (string, []interface{}) {
+	args := make([]interface{}, len(ids))
+	for i, id := range ids {
+		args[i] = id
+	}
+	return strings.TrimSuffix(strings.Repeat("?, ", len(ids)), ", "), args
+}
+
+// queryChirps runs a query selecting chirpColumns from chirps
+func (tx *sqliteTx) queryChirps(query string, args ...interface{}) ([]Chirp, error) {
+	rows, err := tx.tx.Query(query, args...)
+	if err != nil {
+		return []Chirp{}, err
+	}
+	defer rows.Close()
+	chirps := []Chirp{}
+	for rows.Next() {
+		var chirp Chirp
+		err = rows.Scan(&chirp.Id, &chirp.Uid, &chirp.Body, &chirp.AuthorId, &chirp.InReplyTo, &chirp.RefChirpId, &chirp.RefKind, &chirp.Visibility, &chirp.Entities, &chirp.Deleted, &chirp.Hidden, &chirp.CreatedAt, &chirp.UpdatedAt)
+		if err != nil {
+			return []Chirp{}, err
+		}
+		chirps = append(chirps, chirp)
+	}
+	return chirps, rows.Err()
+}
+
+func (tx *sqliteTx) GetChirp(id int) (Chirp, error) {
+	return tx.getChirp("id = ? AND deleted = 0 AND hidden = 0", id)
+}
+
+func (tx *sqliteTx) GetThreadChirp(id int) (Chirp, error) {
+	return tx.getChirp("id = ?", id)
+}
+
+func (tx *sqliteTx) GetReplies(chirpId int) ([]Chirp, error) {
+	return tx.queryChirps("SELECT "+chirpColumns+" FROM chirps WHERE in_reply_to = ? ORDER BY created_at, id", chirpId)
+}
+
+func (tx *sqliteTx) GetRechirps(chirpId int) ([]Chirp, error) {
+	return tx.queryChirps("SELECT "+chirpColumns+" FROM chirps WHERE ref_chirp_id = ? ORDER BY created_at, id", chirpId)
+}
+
+func (tx *sqliteTx) GetChirpByUid(uid string) (Chirp, error) {
+	return tx.getChirp("uid = ? AND uid != '' AND deleted = 0 AND hidden = 0", uid)
+}
+
+// getChirp loads the single chirp matching where
+func (tx *sqliteTx) getChirp(where string, args ...interface{}) (Chirp, error) {
+	var chirp Chirp
+	err := tx.tx.QueryRow("SELECT "+chirpColumns+" FROM chirps WHERE "+where, args...).
+		Scan(&chirp.Id, &chirp.Uid, &chirp.Body, &chirp.AuthorId, &chirp.InReplyTo, &chirp.RefChirpId, &chirp.RefKind, &chirp.Visibility, &chirp.Entities, &chirp.Deleted, &chirp.Hidden, &chirp.CreatedAt, &chirp.UpdatedAt)
+	if errors.Is(err, sql.ErrNoRows) {
+		return Chirp{}, ErrNotFound
+	}
+	if err != nil {
+		return Chirp{}, err
+	}
+	return chirp, nil
+}
+
+func (tx *sqliteTx) InsertChirp(chirp Chirp) (Chirp, error) {
+	uid, err := newUid(tx.s.idScheme)
+	if err != nil {
+		return Chirp{}, err
+	}
+	chirp.Uid = uid
+	chirp.Id, err = tx.nextId(sequenceChirps)
+	if err != nil {
+		return Chirp{}, err
+	}
+	err = tx.writeChirp("INSERT", chirp)
+	if err != nil {
+		return Chirp{}, err
+	}
+	return chirp, nil
+}
+
+func (tx *sqliteTx) PutChirp(chirp Chirp) error {
+	return tx.writeChirp("INSERT OR REPLACE", chirp)
+}
+
+// writeChirp stores chirp with the given kind of INSERT and
+// indexes its hashtags, mentions and words
+func (tx *sqliteTx) writeChirp(insert string, chirp Chirp) error {
+	_, err := tx.exec(insert+" INTO chirps ("+chirpColumns+") VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)",
+		chirp.Id, chirp.Uid, chirp.Body, chirp.AuthorId, chirp.InReplyTo, chirp.RefChirpId, chirp.RefKind, chirp.Visibility, chirp.Entities, chirp.Deleted, chirp.Hidden, chirp.CreatedAt.UTC(), chirp.UpdatedAt.UTC())
+	if err != nil {
+		return err
+	}
+	err = tx.unindexChirp(chirp.Id)
+	if err != nil {
+		return err
+	}
+	if !chirp.listed() {
+		return nil
+	}
+	for _, tag := range chirp.hashtags() {
+		_, err = tx.exec("INSERT INTO hashtags (tag, chirp_id) VALUES (?, ?)", tag, chirp.Id)
+		if err != nil {
+			return err
+		}
+	}
+	for _, userId := range chirp.mentions() {
+		_, err = tx.exec("INSERT INTO mentions (user_id, chirp_id) VALUES (?, ?)", userId, chirp.Id)
+		if err != nil {
+			return err
+		}
+	}
+	return tx.indexSearchTerms(chirp.Id, chirp.Body)
+}
+
+// indexSearchTerms adds the words of body to the search index
+func (tx *sqliteTx) indexSearchTerms(chirpId int, body string) error {
+	for term, positions := range termPositions(body) {
+		positionsBytes, err := json.Marshal(positions)
+		if err != nil {
+			return err
+		}
+		_, err = tx.exec("INSERT INTO search_terms (term, chirp_id, positions, frequency) VALUES (?, ?, ?, ?)",
+			term, chirpId, string(positionsBytes), len(positions))
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// unindexChirp removes a chirp from the hashtag, mention and search indexes
+func (tx *sqliteTx) unindexChirp(chirpId int) error {
+	for _, table := range []string{"hashtags", "mentions", "search_terms"} {
+		_, err := tx.exec("DELETE FROM "+table+" WHERE chirp_id = ?", chirpId)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (tx *sqliteTx) DeleteChirp(id int) error {
+	err := tx.unindexChirp(id)
+	if err != nil {
+		return err
+	}
+	_, err = tx.exec("DELETE FROM likes WHERE chirp_id = ?", id)
+	if err != nil {
+		return err
+	}
+	_, err = tx.exec("DELETE FROM chirp_versions WHERE chirp_id = ?", id)
+	if err != nil {
+		return err
+	}
+	_, err = tx.exec("DELETE FROM chirps WHERE id = ?", id)
+	return err
+}
+
+func (tx *sqliteTx) GetChirpVersions(chirpId int) ([]ChirpVersion, error) {
+	rows, err := tx.tx.Query("SELECT chirp_id, version, body, created_at FROM chirp_versions WHERE chirp_id = ? ORDER BY version", chirpId)
+	if err != nil {
+		return []ChirpVersion{}, err
+	}
+	defer rows.Close()
+	versions := []ChirpVersion{}
+	for rows.Next() {
+		var version ChirpVersion
+		err = rows.Scan(&version.ChirpId, &version.Version, &version.Body, &version.CreatedAt)
+		if err != nil {
+			return []ChirpVersion{}, err
+		}
+		versions = append(versions, version)
+	}
+	return versions, rows.Err()
+}
+
+func (tx *sqliteTx) AddChirpVersion(version ChirpVersion) error {
+	_, err := tx.exec("INSERT INTO chirp_versions (chirp_id, version, body, created_at) VALUES (?, ?, ?, ?)",
+		version.ChirpId, version.Version, version.Body, version.CreatedAt.UTC())
+	return err
+}
+
+func (tx *sqliteTx) PutChirpVersion(version ChirpVersion) error {
+	_, err := tx.exec("UPDATE chirp_versions SET body = ? WHERE chirp_id = ? AND version = ?",
+		version.Body, version.ChirpId, version.Version)
+	return err
+}
+
+func (tx *sqliteTx) GetLike(userId int, chirpId int) (Like, error) {
+	like := Like{UserId: userId, ChirpId: chirpId}
+	err := tx.tx.QueryRow("SELECT created_at FROM likes WHERE user_id = ? AND chirp_id = ?", userId, chirpId).Scan(&like.CreatedAt)
+	if errors.Is(err, sql.ErrNoRows) {
+		return Like{}, ErrNotFound
+	}
+	if err != nil {
+		return Like{}, err
+	}
+	return like, nil
+}
+
+func (tx *sqliteTx) GetLikesByUser(userId int) ([]Like, error) {
+	rows, err := tx.tx.Query("SELECT user_id, chirp_id, created_at FROM likes WHERE user_id = ? ORDER BY created_at DESC, chirp_id DESC", userId)
+	if err != nil {
+		return []Like{}, err
+	}
+	defer rows.Close()
+	likes := []Like{}
+	for rows.Next() {
+		var like Like
+		err = rows.Scan(&like.UserId, &like.ChirpId, &like.CreatedAt)
+		if err != nil {
+			return []Like{}, err
+		}
+		likes = append(likes, like)
+	}
+	return likes, rows.Err()
+}
+
+func (tx *sqliteTx) CountLikes(chirpIds []int) (map[int]int, error) {
+	counts := make(map[int]int, len(chirpIds))
+	if len(chirpIds) == 0 {
+		return counts, nil
+	}
+	placeholders, args := inList(chirpIds)
+	rows, err := tx.tx.Query("SELECT chirp_id, count(*) FROM likes WHERE chirp_id IN ("+placeholders+") AND chirp_id IN (SELECT id FROM chirps WHERE deleted = 0 AND hidden = 0) GROUP BY chirp_id", args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var chirpId, count int
+		err = rows.Scan(&chirpId, &count)
+		if err != nil {
+			return nil, err
+		}
+		counts[chirpId] = count
+	}
+	return counts, rows.Err()
+}
+
+func (tx *sqliteTx) PutLike(like Like) error {
+	_, err := tx.exec("INSERT OR REPLACE INTO likes (user_id, chirp_id, created_at) VALUES (?, ?, ?)",
+		like.UserId, like.ChirpId, like.CreatedAt.UTC())
+	return err
+}
+
+func (tx *sqliteTx) DeleteLike(userId int, chirpId int) error {
+	_, err := tx.exec("DELETE FROM likes WHERE user_id = ? AND chirp_id = ?", userId, chirpId)
+	return err
+}
+
+func (tx *sqliteTx) SearchTerm(term string) (map[int][]int, error) {
+	rows, err := tx.tx.Query("SELECT chirp_id, positions FROM search_terms WHERE term = ?", term)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	postings := make(map[int][]int)
+	for rows.Next() {
+		var chirpId int
+		var positionsJSON string
+		err = rows.Scan(&chirpId, &positionsJSON)
+		if err != nil {
+			return nil, err
+		}
+		var positions []int
+		err = json.Unmarshal([]byte(positionsJSON), &positions)
+		if err != nil {
+			return nil, err
+		}
+		postings[chirpId] = positions
+	}
+	return postings, rows.Err()
+}
+
+func (tx *sqliteTx) SearchStats() (int, int, error) {
+	var docs, tokens int
+	err := tx.tx.QueryRow("SELECT count(DISTINCT chirp_id), coalesce(sum(frequency), 0) FROM search_terms").Scan(&docs, &tokens)
+	return docs, tokens, err
+}
+
+func (tx *sqliteTx) RebuildSearchIndex() (int, error) {
+	return tx.rebuildSearchIndex("SELECT id, body FROM chirps WHERE deleted = 0 AND hidden = 0")
+}
+
+// rebuildSearchIndex indexes the id and body of every chirp query
+// selects from scratch. Migrations pass a query of their own so they
+// don't depend on columns added after them.
+func (tx *sqliteTx) rebuildSearchIndex(query string) (int, error) {
+	_, err := tx.exec("DELETE FROM search_terms")
+	if err != nil {
+		return 0, err
+	}
+	rows, err := tx.tx.Query(query)
+	if err != nil {
+		return 0, err
+	}
+	bodies := make(map[int]string)
+	for rows.Next() {
+		var id int
+		var body string
+		err = rows.Scan(&id, &body)
+		if err != nil {
+			rows.Close()
+			return 0, err
+		}
+		bodies[id] = body
+	}
+	rows.Close()
+	if rows.Err() != nil {
+		return 0, rows.Err()
+	}
+	for id, body := range bodies {
+		err = tx.indexSearchTerms(id, body)
+		if err != nil {
+			return 0, err
+		}
+	}
+	docs, _, err := tx.SearchStats()
+	return docs, err
+}
+
+func (tx *sqliteTx) GetFollow(followerId int, followeeId int) (Follow, error) {
+	follow := Follow{FollowerId: followerId, FolloweeId: followeeId}
+	err := tx.tx.QueryRow("SELECT created_at FROM follows WHERE follower_id = ? AND followee_id = ?", followerId, followeeId).Scan(&follow.CreatedAt)
+	if errors.Is(err, sql.ErrNoRows) {
+		return Follow{}, ErrNotFound
+	}
+	if err != nil {
+		return Follow{}, err
+	}
+	return follow, nil
+}
+
+func (tx *sqliteTx) GetFollowsBy(followerId int) ([]Follow, error) {
+	return tx.queryFollows("SELECT follower_id, followee_id, created_at FROM follows WHERE follower_id = ? ORDER BY created_at DESC, followee_id DESC", followerId)
+}
+
+func (tx *sqliteTx) GetFollowsOf(followeeId int) ([]Follow, error) {
+	return tx.queryFollows("SELECT follower_id, followee_id, created_at FROM follows WHERE followee_id = ? ORDER BY created_at DESC, follower_id DESC", followeeId)
+}
+
+// queryFollows runs a query selecting follower_id, followee_id
+// and created_at from follows
+func (tx *sqliteTx) queryFollows(query string, args ...interface{}) ([]Follow, error) {
+	rows, err := tx.tx.Query(query, args...)
+	if err != nil {
+		return []Follow{}, err
+	}
+	defer rows.Close()
+	follows := []Follow{}
+	for rows.Next() {
+		var follow Follow
+		err = rows.Scan(&follow.FollowerId, &follow.FolloweeId, &follow.CreatedAt)
+		if err != nil {
+			return []Follow{}, err
+		}
+		follows = append(follows, follow)
+	}
+	return follows, rows.Err()
+}
+
+func (tx *sqliteTx) PutFollow(follow Follow) error {
+	_, err := tx.exec("INSERT OR REPLACE INTO follows (follower_id, followee_id, created_at) VALUES (?, ?, ?)",
+		follow.FollowerId, follow.FolloweeId, follow.CreatedAt.UTC())
+	return err
+}
+
+func (tx *sqliteTx) DeleteFollow(followerId int, followeeId int) error {
+	_, err := tx.exec("DELETE FROM follows WHERE follower_id = ? AND followee_id = ?", followerId, followeeId)
+	return err
+}
+
+func (tx *sqliteTx) GetBlock(blockerId int, blockedId int) (Block, error) {
+	block := Block{BlockerId: blockerId, BlockedId: blockedId}
+	err := tx.tx.QueryRow("SELECT created_at FROM blocks WHERE blocker_id = ? AND blocked_id = ?", blockerId, blockedId).Scan(&block.CreatedAt)
+	if errors.Is(err, sql.ErrNoRows) {
+		return Block{}, ErrNotFound
+	}
+	if err != nil {
+		return Block{}, err
+	}
+	return block, nil
+}
+
+func (tx *sqliteTx) PutBlock(block Block) error {
+	_, err := tx.exec("INSERT OR REPLACE INTO blocks (blocker_id, blocked_id, created_at) VALUES (?, ?, ?)",
+		block.BlockerId, block.BlockedId, block.CreatedAt.UTC())
+	return err
+}
+
+func (tx *sqliteTx) DeleteBlock(blockerId int, blockedId int) error {
+	_, err := tx.exec("DELETE FROM blocks WHERE blocker_id = ? AND blocked_id = ?", blockerId, blockedId)
+	return err
+}
+
+func (tx *sqliteTx) GetMute(muterId int, mutedId int) (Mute, error) {
+	mute := Mute{MuterId: muterId, MutedId: mutedId}
+	err := tx.tx.QueryRow("SELECT created_at FROM mutes WHERE muter_id = ? AND muted_id = ?", muterId, mutedId).Scan(&mute.CreatedAt)
+	if errors.Is(err, sql.ErrNoRows) {
+		return Mute{}, ErrNotFound
+	}
+	if err != nil {
+		return Mute{}, err
+	}
+	return mute, nil
+}
+
+func (tx *sqliteTx) PutMute(mute Mute) error {
+	_, err := tx.exec("INSERT OR REPLACE INTO mutes (muter_id, muted_id, created_at) VALUES (?, ?, ?)",
+		mute.MuterId, mute.MutedId, mute.CreatedAt.UTC())
+	return err
+}
+
+func (tx *sqliteTx) DeleteMute(muterId int, mutedId int) error {
+	_, err := tx.exec("DELETE FROM mutes WHERE muter_id = ? AND muted_id = ?", muterId, mutedId)
+	return err
+}
+
+func (tx *sqliteTx) GetBannedWords() ([]BannedWord, error) {
+	rows, err := tx.tx.Query("SELECT word, action, created_at FROM banned_words ORDER BY word")
+	if err != nil {
+		return []BannedWord{}, err
+	}
+	defer rows.Close()
+	words := []BannedWord{}
+	for rows.Next() {
+		var bannedWord BannedWord
+		err = rows.Scan(&bannedWord.Word, &bannedWord.Action, &bannedWord.CreatedAt)
+		if err != nil {
+			return []BannedWord{}, err
+		}
+		words = append(words, bannedWord)
+	}
+	return words, rows.Err()
+}
+
+func (tx *sqliteTx) GetBannedWord(word string) (BannedWord, error) {
+	bannedWord := BannedWord{Word: word}
+	err := tx.tx.QueryRow("SELECT action, created_at FROM banned_words WHERE word = ?", word).Scan(&bannedWord.Action, &bannedWord.CreatedAt)
+	if errors.Is(err, sql.ErrNoRows) {
+		return BannedWord{}, ErrNotFound
+	}
+	if err != nil {
+		return BannedWord{}, err
+	}
+	return bannedWord, nil
+}
+
+func (tx *sqliteTx) PutBannedWord(word BannedWord) error {
+	_, err := tx.exec("INSERT OR REPLACE INTO banned_words (word, action, created_at) VALUES (?, ?, ?)",
+		word.Word, word.Action, word.CreatedAt.UTC())
+	return err
+}
+
+func (tx *sqliteTx) DeleteBannedWord(word string) error {
+	_, err := tx.exec("DELETE FROM banned_words WHERE word = ?", word)
+	return err
+}
+
+const reportColumns = "id, chirp_id, reporter_id, reason, status, note, created_at, resolved_at"
+
+func (tx *sqliteTx) InsertReport(report Report) (Report, error) {
+	var err error
+	report.Id, err = tx.nextId(sequenceReports)
+	if err != nil {
+		return Report{}, err
+	}
+	err = tx.writeReport("INSERT", report)
+	if err != nil {
+		return Report{}, err
+	}
+	return report, nil
+}
+
+func (tx *sqliteTx) PutReport(report Report) error {
+	return tx.writeReport("INSERT OR REPLACE", report)
+}
+
+// writeReport stores report with the given kind of INSERT
+func (tx *sqliteTx) writeReport(insert string, report Report) error {
+	var resolvedAt interface{}
+	if report.ResolvedAt != nil {
+		resolvedAt = report.ResolvedAt.UTC()
+	}
+	_, err := tx.exec(insert+" INTO reports ("+reportColumns+") VALUES (?, ?, ?, ?, ?, ?, ?, ?)",
+		report.Id, report.ChirpId, report.ReporterId, report.Reason, report.Status, report.Note, report.CreatedAt.UTC(), resolvedAt)
+	return err
+}
+
+func (tx *sqliteTx) GetReport(id int) (Report, error) {
+	reports, err := tx.queryReports("SELECT "+reportColumns+" FROM reports WHERE id = ?", id)
+	if err != nil {
+		return Report{}, err
+	}
+	if len(reports) == 0 {
+		return Report{}, ErrNotFound
+	}
+	return reports[0], nil
+}
+
+func (tx *sqliteTx) GetReportsOf(chirpId int) ([]Report, error) {
+	return tx.queryReports("SELECT "+reportColumns+" FROM reports WHERE chirp_id = ? ORDER BY created_at, id", chirpId)
+}
+
+func (tx *sqliteTx) GetReportsBy(reporterId int) ([]Report, error) {
+	return tx.queryReports("SELECT "+reportColumns+" FROM reports WHERE reporter_id = ? ORDER BY created_at DESC, id DESC", reporterId)
+}
+
+func (tx *sqliteTx) GetReportsByStatus(status string) ([]Report, error) {
+	if status == "" {
+		return tx.queryReports("SELECT " + reportColumns + " FROM reports ORDER BY created_at, id")
+	}
+	return tx.queryReports("SELECT "+reportColumns+" FROM reports WHERE status = ? ORDER BY created_at, id", status)
+}
+
+// queryReports runs a query selecting reportColumns from reports
+func (tx *sqliteTx) queryReports(query string, args ...interface{}) ([]Report, error) {
+	rows, err := tx.tx.Query(query, args...)
+	if err != nil {
+		return []Report{}, err
+	}
+	defer rows.Close()
+	reports := []Report{}
+	for rows.Next() {
+		var report Report
+		err = rows.Scan(&report.Id, &report.ChirpId, &report.ReporterId, &report.Reason, &report.Status, &report.Note, &report.CreatedAt, &report.ResolvedAt)
+		if err != nil {
+			return []Report{}, err
+		}
+		reports = append(reports, report)
+	}
+	return reports, rows.Err()
+}
+
+func (tx *sqliteTx) GetUsers() ([]User, error) {
+	rows, err := tx.tx.Query("SELECT " + userColumns + " FROM users ORDER BY id")
+	if err != nil {
+		return []User{}, err
+	}
+	defer rows.Close()
+	users := []User{}
+	for rows.Next() {
+		var user User
+		err = rows.Scan(&user.Id, &user.Uid, &user.Email, &user.Password, &user.IsChirpyRed, &user.CreatedAt, &user.UpdatedAt)
+		if err != nil {
+			return []User{}, err
+		}
+		users = append(users, user)
+	}
+	return users, rows.Err()
+}
+
+func (tx *sqliteTx) GetUser(id int) (User, error) {
+	return tx.getUser("id = ?", id)
+}
+
+func (tx *sqliteTx) GetUserByEmail(email string) (User, error) {
+	return tx.getUser("email_lower = ?", normalizeEmail(email))
+}
+
+// getUser loads the single user matching where
+func (tx *sqliteTx) getUser(where string, args ...interface{}) (User, error) {
+	var user User
+	err := tx.tx.QueryRow("SELECT "+userColumns+" FROM users WHERE "+where, args...).
+		Scan(&user.Id, &user.Uid, &user.Email, &user.Password, &user.IsChirpyRed, &user.CreatedAt, &user.UpdatedAt)
+	if errors.Is(err, sql.ErrNoRows) {
+		return User{}, ErrNotFound
+	}
+	if err != nil {
+		return User{}, err
+	}
+	return user, nil
+}
+
+func (tx *sqliteTx) InsertUser(user User) (User, error) {
+	uid, err := newUid(tx.s.idScheme)
+	if err != nil {
+		return User{}, err
+	}
+	user.Uid = uid
+	user.Id, err = tx.nextId(sequenceUsers)
+	if err != nil {
+		return User{}, err
+	}
+	_, err = tx.exec("INSERT INTO users (id, uid, email, email_lower, password, is_chirpy_red, created_at, updated_at) VALUES (?, ?, ?, ?, ?, ?, ?, ?)",
+		user.Id, user.Uid, user.Email, normalizeEmail(user.Email), user.Password, user.IsChirpyRed, user.CreatedAt.UTC(), user.UpdatedAt.UTC())
+	if err != nil {
+		return User{}, err
+	}
+	return user, nil
+}
+
+func (tx *sqliteTx) PutUser(user User) error {
+	_, err := tx.exec("UPDATE users SET uid = ?, email = ?, email_lower = ?, password = ?, is_chirpy_red = ?, created_at = ?, updated_at = ? WHERE id = ?",
+		user.Uid, user.Email, normalizeEmail(user.Email), user.Password, user.IsChirpyRed, user.CreatedAt.UTC(), user.UpdatedAt.UTC(), user.Id)
+	return err
+}
+
+func (tx *sqliteTx) RevokeToken(token string, revokedToken RevokedToken) error {
+	// Times are stored as text, keep them in UTC so they compare correctly.
+	_, err := tx.exec("INSERT OR REPLACE INTO tokens (token, revoked_at, expires_at) VALUES (?, ?, ?)",
+		token, revokedToken.RevokedAt.UTC(), revokedToken.ExpiresAt.UTC())
+	return err
+}
+
+func (tx *sqliteTx) CheckRevocation(token string) error {
+	var revokedAt time.Time
+	err := tx.tx.QueryRow("SELECT revoked_at FROM tokens WHERE token = ?", token).Scan(&revokedAt)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	return ErrRevoked
+}
+
+func (tx *sqliteTx) PruneRevokedTokens(now time.Time) (int, error) {
+	result, err := tx.exec("DELETE FROM tokens WHERE expires_at < ?", now.UTC())
+	if err != nil {
+		return 0, err
+	}
+	pruned, err := result.RowsAffected()
+	return int(pruned), err
+}
+
+func (tx *sqliteTx) CountRevokedTokens() (int, error) {
+	var count int
+	err := tx.tx.QueryRow("SELECT count(*) FROM tokens").Scan(&count)
+	return count, err
+}
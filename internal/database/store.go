@@ -0,0 +1,115 @@
+package database
+
+import (
+	"fmt"
+	"io"
+	"time"
+)
+
+// Store is everything the handlers need from a database backend.
+// DB (a single JSON file) and SQLiteDB both implement it.
+type Store interface {
+	GetChirps() ([]Chirp, error)
+	GetChirp(id int) (Chirp, error)
+	GetChirpByUid(uid string) (Chirp, error)
+	GetChirpsByAuthor(authorId int) ([]Chirp, error)
+	QueryChirps(query ChirpQuery) ([]Chirp, error)
+	CreateChirp(body string, authorId string) (Chirp, error)
+	PostChirp(chirp Chirp) (Chirp, error)
+	DeleteChirp(chirpId string) error
+	DeleteOwnChirp(chirpId int, authorId int) error
+	CanSeeChirp(chirp Chirp, viewerId int) (bool, error)
+	GetThread(chirpId int, viewerId int) ([]Chirp, error)
+	GetRefChirps(chirps []Chirp, viewerId int) (map[int]Chirp, error)
+	ChirpBelongsToUser(chirpId string, authorId string) error
+	EditChirp(chirpId int, authorId int, body string) (Chirp, error)
+	GetChirpHistory(chirpId int) ([]ChirpVersion, error)
+	LikeChirp(userId int, chirpId int) (ChirpLikes, error)
+	UnlikeChirp(userId int, chirpId int) (ChirpLikes, error)
+	GetChirpLikes(chirpIds []int, userId int) (map[int]ChirpLikes, error)
+	GetLikedChirps(userId int, viewerId int) ([]Chirp, error)
+	FollowUser(followerId int, followeeId int) error
+	UnfollowUser(followerId int, followeeId int) error
+	GetFollowers(userId int) ([]User, error)
+	GetFollowing(userId int) ([]User, error)
+	GetTimeline(userId int, query ChirpQuery) ([]Chirp, error)
+	BlockUser(blockerId int, blockedId int) error
+	UnblockUser(blockerId int, blockedId int) error
+	MuteUser(muterId int, mutedId int) error
+	UnmuteUser(muterId int, mutedId int) error
+	SearchChirps(query SearchQuery) ([]Chirp, error)
+	RebuildSearchIndex() (int, error)
+	GetBannedWords() ([]BannedWord, error)
+	AddBannedWord(word string, action string) (BannedWord, error)
+	RemoveBannedWord(word string) error
+	ReplaceBannedWords(words []BannedWord) error
+	CensorChirps(censor func(body string) string) (int, error)
+	ReportChirp(report Report) (Report, error)
+	GetReport(id int) (Report, error)
+	GetReports(status string) ([]Report, error)
+	GetReportsBy(reporterId int) ([]Report, error)
+	ResolveReport(id int, status string, note string) (Report, error)
+	GetUsers() ([]User, error)
+	GetUserByEmail(email string) (User, error)
+	CreateUser(email string, password string) (User, error)
+	UpdateUser(id int, newEmail string, newPassword string) (User, error)
+	UpgradeUser(id int) (User, error)
+	RevokeToken(token string, expiresAt time.Time) error
+	CheckRevocation(token string) error
+	PruneRevokedTokens(now time.Time) (int, error)
+	CountRevokedTokens() (int, error)
+	// View and Update run several operations against a consistent
+	// snapshot, Update committing them all or none.
+	View(fn func(tx Tx) error) error
+	Update(fn func(tx Tx) error) error
+	Backup(w io.Writer) error
+	Close() error
+}
+
+// Config selects and tunes the store returned by Open.
+type Config struct {
+	// Driver is either "json" (the default) or "sqlite".
+	Driver string
+	Path   string
+	// Journal makes the JSON store write every mutation to an
+	// append-only journal before it is applied.
+	Journal bool
+	// FlushInterval batches writes of the JSON store: mutations are
+	// written out at most this often instead of one file rewrite each.
+	// Zero writes synchronously. Without Journal, a crash loses up to
+	// one interval of writes.
+	FlushInterval time.Duration
+	// IdScheme is IdSchemeSequence (the default), IdSchemeULID or
+	// IdSchemeUUIDv7. The opaque schemes give new chirps and users a
+	// uid next to their integer id, records created before keep none.
+	IdScheme string
+}
+
+// Open opens the store described by cfg.
+func Open(cfg Config) (Store, error) {
+	_, err := newUid(cfg.IdScheme)
+	if err != nil {
+		return nil, err
+	}
+	switch cfg.Driver {
+	case "", "json":
+		db, err := NewDB(cfg.Path)
+		if err != nil {
+			return nil, err
+		}
+		db.journal = cfg.Journal
+		db.idScheme = cfg.IdScheme
+		if cfg.FlushInterval > 0 {
+			db.startFlusher(cfg.FlushInterval)
+		}
+		return db, nil
+	case "sqlite":
+		db, err := NewSQLiteDB(cfg.Path)
+		if err != nil {
+			return nil, err
+		}
+		db.idScheme = cfg.IdScheme
+		return db, nil
+	}
+	return nil, fmt.Errorf("Unknown database driver %q!", cfg.Driver)
+}
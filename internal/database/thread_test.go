@@ -0,0 +1,96 @@
+package database
+
+import (
+	"errors"
+	"testing"
+)
+
+func threadIds(t *testing.T, db Store, chirpId int) []int {
+	t.Helper()
+	thread, err := db.GetThread(chirpId, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ids := []int{}
+	for _, chirp := range thread {
+		ids = append(ids, chirp.Id)
+	}
+	return ids
+}
+
+func equalIds(a []int, b []int) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
+
+func TestThreads(t *testing.T) {
+	for name, db := range openStores(t) {
+		t.Run(name, func(t *testing.T) {
+			// 1
+			// ├── 2
+			// │   └── 4
+			// └── 3
+			for _, parent := range []int{0, 1, 1, 2} {
+				_, err := db.PostChirp(Chirp{Body: "hello", AuthorId: 1, InReplyTo: parent})
+				if err != nil {
+					t.Fatal(err)
+				}
+			}
+			if ids := threadIds(t, db, 4); !equalIds(ids, []int{1, 2, 4}) {
+				t.Fatalf("got thread %v of chirp 4, want [1 2 4]", ids)
+			}
+			if ids := threadIds(t, db, 1); !equalIds(ids, []int{1, 2, 4, 3}) {
+				t.Fatalf("got thread %v of chirp 1, want [1 2 4 3]", ids)
+			}
+
+			_, err := db.PostChirp(Chirp{Body: "hello", AuthorId: 1, InReplyTo: 42})
+			if !errors.Is(err, ErrNoParent) {
+				t.Fatalf("replying to a missing chirp: got %v, want ErrNoParent", err)
+			}
+
+			err = db.DeleteOwnChirp(2, 2)
+			if !errors.Is(err, ErrForbidden) {
+				t.Fatalf("got %v, want ErrForbidden", err)
+			}
+			err = db.DeleteOwnChirp(2, 1)
+			if err != nil {
+				t.Fatal(err)
+			}
+			_, err = db.GetChirp(2)
+			if !errors.Is(err, ErrNotFound) {
+				t.Fatalf("got %v, want the tombstone to be hidden", err)
+			}
+			chirps, _ := db.GetChirps()
+			if len(chirps) != 3 {
+				t.Fatalf("got %d chirps, want the tombstone left out", len(chirps))
+			}
+			thread, err := db.GetThread(4, 0)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(thread) != 3 || !thread[1].Deleted || thread[1].Body != "" {
+				t.Fatalf("got %+v, want chirp 2 as a tombstone", thread)
+			}
+			_, err = db.PostChirp(Chirp{Body: "hello", AuthorId: 1, InReplyTo: 2})
+			if !errors.Is(err, ErrNoParent) {
+				t.Fatalf("replying to a tombstone: got %v, want ErrNoParent", err)
+			}
+
+			// The tombstone goes with its last reply.
+			err = db.DeleteChirp("4")
+			if err != nil {
+				t.Fatal(err)
+			}
+			if ids := threadIds(t, db, 1); !equalIds(ids, []int{1, 3}) {
+				t.Fatalf("got thread %v of chirp 1, want [1 3]", ids)
+			}
+		})
+	}
+}
@@ -0,0 +1,697 @@
+package database
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"time"
+
+	"golang.org/x/crypto/bcrypt"
+)
+
+// Tx is a consistent view of the database inside View or Update.
+// Changes made through it become visible to others all at once when
+// the Update function returns nil, and are discarded if it fails.
+type Tx interface {
+	GetChirps() ([]Chirp, error)
+	GetChirp(id int) (Chirp, error)
+	// GetThreadChirp is GetChirp that also returns tombstones
+	GetThreadChirp(id int) (Chirp, error)
+	// GetReplies returns the direct replies to a chirp, tombstones
+	// included, oldest first
+	GetReplies(chirpId int) ([]Chirp, error)
+	// GetRechirps returns the rechirps and quotes of a chirp, oldest first
+	GetRechirps(chirpId int) ([]Chirp, error)
+	GetChirpByUid(uid string) (Chirp, error)
+	GetChirpsByAuthor(authorId int) ([]Chirp, error)
+	QueryChirps(query ChirpQuery) ([]Chirp, error)
+	// InsertChirp stores a new chirp, assigning its Id and Uid
+	InsertChirp(chirp Chirp) (Chirp, error)
+	// PutChirp stores chirp, replacing the chirp with its id
+	PutChirp(chirp Chirp) error
+	// DeleteChirp deletes a chirp together with its history and likes
+	// outright, Store.DeleteChirp is the one that leaves tombstones
+	DeleteChirp(id int) error
+	// GetChirpVersions returns the earlier versions of a chirp, oldest first
+	GetChirpVersions(chirpId int) ([]ChirpVersion, error)
+	AddChirpVersion(version ChirpVersion) error
+	// PutChirpVersion replaces the body of an existing version
+	PutChirpVersion(version ChirpVersion) error
+	GetLike(userId int, chirpId int) (Like, error)
+	// GetLikesByUser returns the likes of a user, newest first
+	GetLikesByUser(userId int) ([]Like, error)
+	// CountLikes returns the number of likes of each of chirpIds,
+	// none for deleted and hidden chirps
+	CountLikes(chirpIds []int) (map[int]int, error)
+	// PutLike stores like, replacing the one of the same user and chirp
+	PutLike(like Like) error
+	DeleteLike(userId int, chirpId int) error
+	// SearchTerm returns where a word is in each chirp that has it
+	SearchTerm(term string) (map[int][]int, error)
+	// SearchStats returns how many chirps have words in the
+	// search index and how many words they have between them
+	SearchStats() (int, int, error)
+	RebuildSearchIndex() (int, error)
+	GetFollow(followerId int, followeeId int) (Follow, error)
+	// GetFollowsBy returns who a user follows, newest first
+	GetFollowsBy(followerId int) ([]Follow, error)
+	// GetFollowsOf returns who follows a user, newest first
+	GetFollowsOf(followeeId int) ([]Follow, error)
+	// PutFollow stores follow, replacing the one of the same users
+	PutFollow(follow Follow) error
+	DeleteFollow(followerId int, followeeId int) error
+	GetBlock(blockerId int, blockedId int) (Block, error)
+	// PutBlock stores block, replacing the one of the same users
+	PutBlock(block Block) error
+	DeleteBlock(blockerId int, blockedId int) error
+	GetMute(muterId int, mutedId int) (Mute, error)
+	// PutMute stores mute, replacing the one of the same users
+	PutMute(mute Mute) error
+	DeleteMute(muterId int, mutedId int) error
+	// GetBannedWords returns the profanity list, alphabetically
+	GetBannedWords() ([]BannedWord, error)
+	GetBannedWord(word string) (BannedWord, error)
+	// PutBannedWord stores word, replacing the entry for the same word
+	PutBannedWord(word BannedWord) error
+	DeleteBannedWord(word string) error
+	// InsertReport stores a new report, assigning its Id
+	InsertReport(report Report) (Report, error)
+	// PutReport overwrites an existing report
+	PutReport(report Report) error
+	GetReport(id int) (Report, error)
+	// GetReportsOf returns the reports on a chirp, oldest first
+	GetReportsOf(chirpId int) ([]Report, error)
+	// GetReportsBy returns the reports a user filed, newest first
+	GetReportsBy(reporterId int) ([]Report, error)
+	// GetReportsByStatus returns the reports with status, or all of
+	// them for "", oldest first
+	GetReportsByStatus(status string) ([]Report, error)
+	GetUsers() ([]User, error)
+	GetUser(id int) (User, error)
+	GetUserByEmail(email string) (User, error)
+	// InsertUser stores a new user, assigning its Id and Uid
+	InsertUser(user User) (User, error)
+	// PutUser overwrites an existing user
+	PutUser(user User) error
+	RevokeToken(token string, revokedToken RevokedToken) error
+	CheckRevocation(token string) error
+	PruneRevokedTokens(now time.Time) (int, error)
+	CountRevokedTokens() (int, error)
+}
+
+// errReadOnly is returned by the mutating methods of a Tx from View
+var errReadOnly = errors.New("Read-only transaction!")
+
+// transactor is the part of a backend the Store methods are built on
+type transactor interface {
+	View(fn func(tx Tx) error) error
+	Update(fn func(tx Tx) error) error
+}
+
+// txStore implements the Store methods on top of a backend's
+// transactions, so every backend behaves the same
+type txStore struct {
+	backend transactor
+}
+
+func (s txStore) GetChirps() ([]Chirp, error) {
+	var chirps []Chirp
+	err := s.backend.View(func(tx Tx) error {
+		var err error
+		chirps, err = tx.GetChirps()
+		return err
+	})
+	return chirps, err
+}
+
+func (s txStore) GetChirp(id int) (Chirp, error) {
+	var chirp Chirp
+	err := s.backend.View(func(tx Tx) error {
+		var err error
+		chirp, err = tx.GetChirp(id)
+		return err
+	})
+	return chirp, err
+}
+
+func (s txStore) GetChirpByUid(uid string) (Chirp, error) {
+	var chirp Chirp
+	err := s.backend.View(func(tx Tx) error {
+		var err error
+		chirp, err = tx.GetChirpByUid(uid)
+		return err
+	})
+	return chirp, err
+}
+
+func (s txStore) GetChirpsByAuthor(authorId int) ([]Chirp, error) {
+	var chirps []Chirp
+	err := s.backend.View(func(tx Tx) error {
+		var err error
+		chirps, err = tx.GetChirpsByAuthor(authorId)
+		return err
+	})
+	return chirps, err
+}
+
+// QueryChirps returns the chirps selected by query, in its order
+func (s txStore) QueryChirps(query ChirpQuery) ([]Chirp, error) {
+	var chirps []Chirp
+	err := s.backend.View(func(tx Tx) error {
+		var err error
+		chirps, err = tx.QueryChirps(query)
+		return err
+	})
+	return chirps, err
+}
+
+// CreateChirp creates a new chirp and saves it
+func (s txStore) CreateChirp(body string, authorId string) (Chirp, error) {
+	authorIdInt, err := strconv.Atoi(authorId)
+	if err != nil {
+		return Chirp{}, err
+	}
+	return s.PostChirp(Chirp{Body: body, AuthorId: authorIdInt})
+}
+
+// PostChirp creates a chirp from the Body, AuthorId, InReplyTo,
+// RefChirpId, RefKind and Visibility of chirp, finding the entities in
+// its body. Visibility defaults to public. It fails with ErrNoParent if
+// it replies to a chirp that doesn't exist or its author may not see,
+// and with ErrBlocked if it replies to or mentions a user who blocked
+// its author. Replying to or resharing a plain rechirp is the same as
+// doing so to the chirp it reshares.
+func (s txStore) PostChirp(chirp Chirp) (Chirp, error) {
+	var newChirp Chirp
+	err := s.backend.Update(func(tx Tx) error {
+		var err error
+		if chirp.InReplyTo != 0 {
+			chirp.InReplyTo, err = resharedChirpId(tx, chirp.InReplyTo)
+			if errors.Is(err, ErrNotFound) {
+				return ErrNoParent
+			}
+			if err != nil {
+				return err
+			}
+			parent, err := tx.GetChirp(chirp.InReplyTo)
+			if err != nil {
+				return err
+			}
+			ok, err := canSee(tx, parent, chirp.AuthorId)
+			if err != nil {
+				return err
+			}
+			if !ok {
+				return ErrNoParent
+			}
+			err = checkBlocked(tx, chirp.AuthorId, parent.AuthorId)
+			if err != nil {
+				return err
+			}
+		}
+		if chirp.RefChirpId != 0 {
+			chirp.RefChirpId, err = resharedChirpId(tx, chirp.RefChirpId)
+			if err != nil {
+				return err
+			}
+			refChirp, err := tx.GetChirp(chirp.RefChirpId)
+			if err != nil {
+				return err
+			}
+			ok, err := canSee(tx, refChirp, chirp.AuthorId)
+			if err != nil {
+				return err
+			}
+			if !ok {
+				return ErrNotFound
+			}
+		}
+		if chirp.Visibility == "" {
+			chirp.Visibility = VisibilityPublic
+		}
+		if chirp.RefKind == RefRechirp {
+			chirp.Body = ""
+			rechirps, err := tx.GetRechirps(chirp.RefChirpId)
+			if err != nil {
+				return err
+			}
+			for _, rechirp := range rechirps {
+				if rechirp.RefKind == RefRechirp && rechirp.AuthorId == chirp.AuthorId {
+					return ErrRechirped
+				}
+			}
+		}
+		entities, err := chirpEntities(tx, chirp.Body)
+		if err != nil {
+			return err
+		}
+		err = checkMentions(tx, chirp.AuthorId, entities)
+		if err != nil {
+			return err
+		}
+		// Taken inside the transaction so creation times follow the ids.
+		now := time.Now().UTC()
+		newChirp, err = tx.InsertChirp(Chirp{
+			Body:       chirp.Body,
+			AuthorId:   chirp.AuthorId,
+			InReplyTo:  chirp.InReplyTo,
+			RefChirpId: chirp.RefChirpId,
+			RefKind:    chirp.RefKind,
+			Visibility: chirp.Visibility,
+			Entities:   entities,
+			CreatedAt:  now,
+			UpdatedAt:  now,
+		})
+		return err
+	})
+	return newChirp, err
+}
+
+// resharedChirpId returns the id of the chirp a plain rechirp
+// reshares, or chirpId itself for any other chirp
+func resharedChirpId(tx Tx, chirpId int) (int, error) {
+	chirp, err := tx.GetChirp(chirpId)
+	if err != nil {
+		return 0, err
+	}
+	if chirp.RefKind == RefRechirp {
+		return chirp.RefChirpId, nil
+	}
+	return chirp.Id, nil
+}
+
+func (s txStore) DeleteChirp(chirpId string) error {
+	chirpIdInt, err := strconv.Atoi(chirpId)
+	if err != nil {
+		return err
+	}
+	return s.backend.Update(func(tx Tx) error {
+		return deleteChirp(tx, chirpIdInt)
+	})
+}
+
+// DeleteOwnChirp deletes a chirp if it was written by authorId
+func (s txStore) DeleteOwnChirp(chirpId int, authorId int) error {
+	return s.backend.Update(func(tx Tx) error {
+		_, err := ownChirp(tx, chirpId, authorId)
+		if err != nil {
+			return err
+		}
+		return deleteChirp(tx, chirpId)
+	})
+}
+
+// deleteChirp deletes a chirp along with its plain rechirps. A chirp
+// that still has replies or quotes is left as a tombstone, and
+// tombstones nothing refers to anymore are cleared away.
+func deleteChirp(tx Tx, chirpId int) error {
+	chirp, err := tx.GetThreadChirp(chirpId)
+	if errors.Is(err, ErrNotFound) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	replies, err := tx.GetReplies(chirpId)
+	if err != nil {
+		return err
+	}
+	rechirps, err := tx.GetRechirps(chirpId)
+	if err != nil {
+		return err
+	}
+	quoted := false
+	for _, rechirp := range rechirps {
+		if rechirp.RefKind == RefQuote {
+			quoted = true
+			continue
+		}
+		err = deleteChirp(tx, rechirp.Id)
+		if err != nil {
+			return err
+		}
+	}
+	referenced := len(replies) > 0 || quoted
+	if chirp.Deleted && referenced {
+		return nil
+	}
+	err = tx.DeleteChirp(chirpId)
+	if err != nil {
+		return err
+	}
+	if referenced {
+		err = tx.PutChirp(Chirp{
+			Id:        chirp.Id,
+			InReplyTo: chirp.InReplyTo,
+			Deleted:   true,
+			CreatedAt: chirp.CreatedAt,
+			UpdatedAt: time.Now().UTC(),
+		})
+		if err != nil {
+			return err
+		}
+	}
+	// Tombstones keep no reference, so a quoted tombstone may be free to go.
+	err = clearTombstone(tx, chirp.RefChirpId)
+	if err != nil || referenced {
+		return err
+	}
+	return clearTombstone(tx, chirp.InReplyTo)
+}
+
+// clearTombstone deletes chirpId if it is a tombstone
+// nothing refers to anymore
+func clearTombstone(tx Tx, chirpId int) error {
+	if chirpId == 0 {
+		return nil
+	}
+	chirp, err := tx.GetThreadChirp(chirpId)
+	if errors.Is(err, ErrNotFound) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	if !chirp.Deleted {
+		return nil
+	}
+	return deleteChirp(tx, chirpId)
+}
+
+// GetRefChirps returns the chirps that chirps rechirp or quote by id
+// as viewerId sees them, tombstones and placeholders of hidden chirps
+// included
+func (s txStore) GetRefChirps(chirps []Chirp, viewerId int) (map[int]Chirp, error) {
+	refChirps := make(map[int]Chirp)
+	err := s.backend.View(func(tx Tx) error {
+		for _, chirp := range chirps {
+			if chirp.RefChirpId == 0 {
+				continue
+			}
+			refChirp, err := tx.GetThreadChirp(chirp.RefChirpId)
+			if err != nil {
+				return err
+			}
+			refChirps[refChirp.Id], err = visibleTo(tx, refChirp, viewerId)
+			if err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return refChirps, nil
+}
+
+// GetThread returns the conversation a chirp is part of: its
+// ancestors from the first chirp down, the chirp itself and then its
+// replies depth first, each level oldest first, as viewerId sees it.
+// Deleted and hidden chirps along the way, and those viewerId may
+// not see, show up as tombstones.
+func (s txStore) GetThread(chirpId int, viewerId int) ([]Chirp, error) {
+	var thread []Chirp
+	err := s.backend.View(func(tx Tx) error {
+		chirp, err := tx.GetThreadChirp(chirpId)
+		if err != nil {
+			return err
+		}
+		ancestors := []Chirp{}
+		for parentId := chirp.InReplyTo; parentId != 0; {
+			parent, err := tx.GetThreadChirp(parentId)
+			if err != nil {
+				return err
+			}
+			visible, err := visibleTo(tx, parent, viewerId)
+			if err != nil {
+				return err
+			}
+			ancestors = append(ancestors, visible)
+			parentId = parent.InReplyTo
+		}
+		for i := len(ancestors) - 1; i >= 0; i-- {
+			thread = append(thread, ancestors[i])
+		}
+		var addReplies func(chirp Chirp) error
+		addReplies = func(chirp Chirp) error {
+			visible, err := visibleTo(tx, chirp, viewerId)
+			if err != nil {
+				return err
+			}
+			thread = append(thread, visible)
+			replies, err := tx.GetReplies(chirp.Id)
+			if err != nil {
+				return err
+			}
+			for _, reply := range replies {
+				err = addReplies(reply)
+				if err != nil {
+					return err
+				}
+			}
+			return nil
+		}
+		return addReplies(chirp)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return thread, nil
+}
+
+// ChirpBelongsToUser tells apart a chirp that doesn't exist
+// from one written by somebody else
+func (s txStore) ChirpBelongsToUser(chirpId string, authorId string) error {
+	chirpIdInt, err := strconv.Atoi(chirpId)
+	if err != nil {
+		return err
+	}
+	authorIdInt, err := strconv.Atoi(authorId)
+	if err != nil {
+		return err
+	}
+	return s.backend.View(func(tx Tx) error {
+		_, err := ownChirp(tx, chirpIdInt, authorIdInt)
+		return err
+	})
+}
+
+// ownChirp returns the chirp if it was written by authorId,
+// ErrNotFound or ErrForbidden if not
+func ownChirp(tx Tx, chirpId int, authorId int) (Chirp, error) {
+	chirp, err := tx.GetChirp(chirpId)
+	if err != nil {
+		return Chirp{}, err
+	}
+	if chirp.AuthorId != authorId {
+		return Chirp{}, ErrForbidden
+	}
+	return chirp, nil
+}
+
+// EditChirp replaces the body of a chirp by authorId,
+// keeping the old body in its history
+func (s txStore) EditChirp(chirpId int, authorId int, body string) (Chirp, error) {
+	var editedChirp Chirp
+	err := s.backend.Update(func(tx Tx) error {
+		chirp, err := ownChirp(tx, chirpId, authorId)
+		if err != nil {
+			return err
+		}
+		// There is no body to a plain rechirp.
+		if chirp.RefKind == RefRechirp {
+			return ErrForbidden
+		}
+		editedChirp = chirp
+		if chirp.Body == body {
+			return nil
+		}
+		versions, err := tx.GetChirpVersions(chirpId)
+		if err != nil {
+			return err
+		}
+		err = tx.AddChirpVersion(ChirpVersion{
+			ChirpId:   chirpId,
+			Version:   len(versions) + 1,
+			Body:      chirp.Body,
+			CreatedAt: chirp.UpdatedAt,
+		})
+		if err != nil {
+			return err
+		}
+		chirp.Body = body
+		chirp.Entities, err = chirpEntities(tx, body)
+		if err != nil {
+			return err
+		}
+		err = checkMentions(tx, authorId, chirp.Entities)
+		if err != nil {
+			return err
+		}
+		chirp.UpdatedAt = time.Now().UTC()
+		editedChirp = chirp
+		return tx.PutChirp(chirp)
+	})
+	if err != nil {
+		return Chirp{}, err
+	}
+	return editedChirp, nil
+}
+
+// GetChirpHistory returns every version of a chirp, oldest
+// first, ending with the current one
+func (s txStore) GetChirpHistory(chirpId int) ([]ChirpVersion, error) {
+	var versions []ChirpVersion
+	err := s.backend.View(func(tx Tx) error {
+		chirp, err := tx.GetChirp(chirpId)
+		if err != nil {
+			return err
+		}
+		versions, err = tx.GetChirpVersions(chirpId)
+		if err != nil {
+			return err
+		}
+		versions = append(versions, ChirpVersion{
+			ChirpId:   chirpId,
+			Version:   len(versions) + 1,
+			Body:      chirp.Body,
+			CreatedAt: chirp.UpdatedAt,
+		})
+		return nil
+	})
+	return versions, err
+}
+
+func (s txStore) GetUsers() ([]User, error) {
+	var users []User
+	err := s.backend.View(func(tx Tx) error {
+		var err error
+		users, err = tx.GetUsers()
+		return err
+	})
+	return users, err
+}
+
+// GetUserByEmail returns the user with email, ignoring case
+func (s txStore) GetUserByEmail(email string) (User, error) {
+	var user User
+	err := s.backend.View(func(tx Tx) error {
+		var err error
+		user, err = tx.GetUserByEmail(email)
+		return err
+	})
+	return user, err
+}
+
+// checkEmailFree fails if email belongs to a user other than id
+func checkEmailFree(tx Tx, email string, id int) error {
+	owner, err := tx.GetUserByEmail(email)
+	if err != nil {
+		if errors.Is(err, ErrNotFound) {
+			return nil
+		}
+		return err
+	}
+	if owner.Id != id {
+		return ErrDuplicateEmail
+	}
+	return nil
+}
+
+func (s txStore) CreateUser(email string, password string) (User, error) {
+	var newUser User
+	err := s.backend.Update(func(tx Tx) error {
+		err := checkEmailFree(tx, email, 0)
+		if err != nil {
+			return err
+		}
+		now := time.Now().UTC()
+		newUser, err = tx.InsertUser(User{Email: email, Password: password, CreatedAt: now, UpdatedAt: now})
+		return err
+	})
+	return newUser, err
+}
+
+func (s txStore) UpgradeUser(id int) (User, error) {
+	var modifiedUser User
+	err := s.backend.Update(func(tx Tx) error {
+		user, err := tx.GetUser(id)
+		if err != nil {
+			return err
+		}
+		user.IsChirpyRed = true
+		user.UpdatedAt = time.Now().UTC()
+		modifiedUser = user
+		return tx.PutUser(user)
+	})
+	if err != nil {
+		return User{}, err
+	}
+	return modifiedUser, nil
+}
+
+func (s txStore) UpdateUser(id int, newEmail string, newPassword string) (User, error) {
+	// Hashing is slow, keep it out of the transaction.
+	hashedPassword, err := bcrypt.GenerateFromPassword([]byte(newPassword), 10)
+	if err != nil {
+		return User{}, err
+	}
+	var modifiedUser User
+	err = s.backend.Update(func(tx Tx) error {
+		user, err := tx.GetUser(id)
+		if err != nil {
+			return err
+		}
+		err = checkEmailFree(tx, newEmail, id)
+		if err != nil {
+			return err
+		}
+		user.Email = newEmail
+		user.Password = fmt.Sprintf("%s", hashedPassword)
+		user.UpdatedAt = time.Now().UTC()
+		modifiedUser = user
+		return tx.PutUser(user)
+	})
+	if err != nil {
+		return User{}, err
+	}
+	return modifiedUser, nil
+}
+
+// RevokeToken revokes token until expiresAt, when it stops being valid anyway
+func (s txStore) RevokeToken(token string, expiresAt time.Time) error {
+	return s.backend.Update(func(tx Tx) error {
+		return tx.RevokeToken(token, RevokedToken{RevokedAt: time.Now(), ExpiresAt: expiresAt})
+	})
+}
+
+// CheckRevocation returns ErrRevoked if token has been revoked
+func (s txStore) CheckRevocation(token string) error {
+	return s.backend.View(func(tx Tx) error {
+		return tx.CheckRevocation(token)
+	})
+}
+
+// PruneRevokedTokens forgets revocations of tokens that expired
+// before now and returns how many were removed
+func (s txStore) PruneRevokedTokens(now time.Time) (int, error) {
+	var pruned int
+	err := s.backend.Update(func(tx Tx) error {
+		var err error
+		pruned, err = tx.PruneRevokedTokens(now)
+		return err
+	})
+	return pruned, err
+}
+
+// CountRevokedTokens returns the size of the revoked token table
+func (s txStore) CountRevokedTokens() (int, error) {
+	var count int
+	err := s.backend.View(func(tx Tx) error {
+		var err error
+		count, err = tx.CountRevokedTokens()
+		return err
+	})
+	return count, err
+}
@@ -0,0 +1,84 @@
+package database
+
+import (
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestUpdateRollsBack(t *testing.T) {
+	for name, db := range openStores(t) {
+		t.Run(name, func(t *testing.T) {
+			user, err := db.CreateUser("walt@example.com", "hash")
+			if err != nil {
+				t.Fatal(err)
+			}
+			failure := errors.New("changed my mind")
+			err = db.Update(func(tx Tx) error {
+				chirp, err := tx.InsertChirp(Chirp{Body: "hello", AuthorId: user.Id})
+				if err != nil {
+					return err
+				}
+				// Changes are visible inside the transaction.
+				_, err = tx.GetChirp(chirp.Id)
+				if err != nil {
+					return err
+				}
+				user.Email = "heisenberg@example.com"
+				err = tx.PutUser(user)
+				if err != nil {
+					return err
+				}
+				err = tx.RevokeToken("some.jwt", RevokedToken{RevokedAt: time.Now(), ExpiresAt: time.Now().Add(time.Hour)})
+				if err != nil {
+					return err
+				}
+				return failure
+			})
+			if err != failure {
+				t.Fatalf("got %v, want the error returned by the function", err)
+			}
+
+			chirps, err := db.GetChirps()
+			if err != nil || len(chirps) != 0 {
+				t.Fatalf("got %+v, %v, want no chirps", chirps, err)
+			}
+			_, err = db.GetUserByEmail("walt@example.com")
+			if err != nil {
+				t.Fatalf("user update not rolled back: %v", err)
+			}
+			_, err = db.GetUserByEmail("heisenberg@example.com")
+			if err == nil {
+				t.Fatal("rolled back email still resolves")
+			}
+			if db.CheckRevocation("some.jwt") != nil {
+				t.Fatal("revocation not rolled back")
+			}
+			chirp, err := db.CreateChirp("hello", "1")
+			if err != nil {
+				t.Fatal(err)
+			}
+			if chirp.Id != 1 {
+				t.Fatalf("got chirp id %d, want the rolled back id 1 to be handed out again", chirp.Id)
+			}
+		})
+	}
+}
+
+func TestViewIsReadOnly(t *testing.T) {
+	for name, db := range openStores(t) {
+		t.Run(name, func(t *testing.T) {
+			err := db.View(func(tx Tx) error {
+				_, err := tx.InsertChirp(Chirp{Body: "hello", AuthorId: 1})
+				return err
+			})
+			if err == nil {
+				t.Fatal("inserted a chirp in a read-only transaction")
+			}
+			chirps, err := db.GetChirps()
+			if err != nil || len(chirps) != 0 {
+				t.Fatalf("got %+v, %v, want no chirps", chirps, err)
+			}
+		})
+	}
+}
@@ -0,0 +1,69 @@
+package database
+
+import "errors"
+
+// Who may see a chirp besides its author
+const (
+	VisibilityPublic    = "public"
+	VisibilityFollowers = "followers"
+	VisibilityPrivate   = "private"
+)
+
+// ValidVisibility reports whether visibility is one a chirp may have
+func ValidVisibility(visibility string) bool {
+	switch visibility {
+	case VisibilityPublic, VisibilityFollowers, VisibilityPrivate:
+		return true
+	}
+	return false
+}
+
+// canSee reports whether viewerId, 0 for someone who isn't logged
+// in, may see chirp. Tombstones have no visibility and are public.
+func canSee(tx Tx, chirp Chirp, viewerId int) (bool, error) {
+	if viewerId != 0 && viewerId == chirp.AuthorId {
+		return true, nil
+	}
+	switch chirp.Visibility {
+	case VisibilityFollowers:
+		if viewerId == 0 {
+			return false, nil
+		}
+		_, err := tx.GetFollow(viewerId, chirp.AuthorId)
+		if errors.Is(err, ErrNotFound) {
+			return false, nil
+		}
+		if err != nil {
+			return false, err
+		}
+		return true, nil
+	case VisibilityPrivate:
+		return false, nil
+	}
+	return true, nil
+}
+
+// visibleTo returns chirp as viewerId sees it in threads and
+// quotes, which is its placeholder if they may not see it
+func visibleTo(tx Tx, chirp Chirp, viewerId int) (Chirp, error) {
+	ok, err := canSee(tx, chirp, viewerId)
+	if err != nil {
+		return Chirp{}, err
+	}
+	if !ok {
+		chirp.Hidden = true
+	}
+	return chirp.placeholder(), nil
+}
+
+// CanSeeChirp reports whether viewerId, 0 for someone
+// who isn't logged in, may see chirp
+func (s txStore) CanSeeChirp(chirp Chirp, viewerId int) (bool, error) {
+	var ok bool
+	err := s.backend.View(func(tx Tx) error {
+		var err error
+		ok, err = canSee(tx, chirp, viewerId)
+		return err
+	})
+	return ok, err
+}
@@ -0,0 +1,127 @@
+package database
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestVisibility(t *testing.T) {
+	for name, db := range openStores(t) {
+		t.Run(name, func(t *testing.T) {
+			for _, email := range []string{"walt@example.com", "jesse@example.com", "skyler@example.com"} {
+				_, err := db.CreateUser(email, "hash")
+				if err != nil {
+					t.Fatal(err)
+				}
+			}
+			err := db.FollowUser(2, 1)
+			if err != nil {
+				t.Fatal(err)
+			}
+			for _, visibility := range []string{"", VisibilityFollowers, VisibilityPrivate} {
+				chirp, err := db.PostChirp(Chirp{Body: "say my name " + visibility, AuthorId: 1, Visibility: visibility})
+				if err != nil {
+					t.Fatal(err)
+				}
+				if visibility == "" && chirp.Visibility != VisibilityPublic {
+					t.Fatalf("got visibility %q, want public by default", chirp.Visibility)
+				}
+			}
+
+			// Walt sees all, Jesse follows him and Skyler doesn't.
+			for viewerId, want := range map[int][]int{0: {1}, 1: {1, 2, 3}, 2: {1, 2}, 3: {1}} {
+				chirps, err := db.QueryChirps(ChirpQuery{ViewerId: viewerId})
+				if err != nil {
+					t.Fatal(err)
+				}
+				if len(chirps) != len(want) {
+					t.Fatalf("user %d got %+v, want chirps %v", viewerId, chirps, want)
+				}
+				for i, chirp := range chirps {
+					if chirp.Id != want[i] {
+						t.Fatalf("user %d got %+v, want chirps %v", viewerId, chirps, want)
+					}
+				}
+				found, err := db.SearchChirps(SearchQuery{Text: "name", ViewerId: viewerId})
+				if err != nil || len(found) != len(want) {
+					t.Fatalf("user %d found %+v, %v, want chirps %v", viewerId, found, err, want)
+				}
+				for chirpId := 1; chirpId <= 3; chirpId++ {
+					chirp, err := db.GetChirp(chirpId)
+					if err != nil {
+						t.Fatal(err)
+					}
+					ok, err := db.CanSeeChirp(chirp, viewerId)
+					if err != nil || ok != containsId(want, chirpId) {
+						t.Fatalf("user %d may see chirp %d: got %v, %v", viewerId, chirpId, ok, err)
+					}
+				}
+			}
+
+			_, err = db.LikeChirp(3, 2)
+			if !errors.Is(err, ErrNotFound) {
+				t.Fatalf("liking a chirp for followers only: got %v, want ErrNotFound", err)
+			}
+			_, err = db.PostChirp(Chirp{Body: "hi", AuthorId: 3, InReplyTo: 2})
+			if !errors.Is(err, ErrNoParent) {
+				t.Fatalf("replying to a chirp for followers only: got %v, want ErrNoParent", err)
+			}
+			_, err = db.PostChirp(Chirp{AuthorId: 2, RefChirpId: 3, RefKind: RefRechirp})
+			if !errors.Is(err, ErrNotFound) {
+				t.Fatalf("rechirping a private chirp: got %v, want ErrNotFound", err)
+			}
+			_, err = db.ReportChirp(Report{ChirpId: 3, ReporterId: 2, Reason: "spam"})
+			if !errors.Is(err, ErrNotFound) {
+				t.Fatalf("reporting a private chirp: got %v, want ErrNotFound", err)
+			}
+
+			_, err = db.LikeChirp(2, 2)
+			if err != nil {
+				t.Fatal(err)
+			}
+			reply, err := db.PostChirp(Chirp{Body: "yeah", AuthorId: 2, InReplyTo: 2})
+			if err != nil {
+				t.Fatal(err)
+			}
+			thread, err := db.GetThread(reply.Id, 3)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(thread) != 2 || !thread[0].Hidden || thread[0].Body != "" || thread[1].Id != reply.Id {
+				t.Fatalf("got thread %+v, want the chirp for followers hidden from user 3", thread)
+			}
+			thread, err = db.GetThread(reply.Id, 2)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(thread) != 2 || thread[0].Hidden {
+				t.Fatalf("got thread %+v, want a follower to see it all", thread)
+			}
+			liked, err := db.GetLikedChirps(2, 3)
+			if err != nil || len(liked) != 0 {
+				t.Fatalf("got %+v, %v, want the like hidden from user 3", liked, err)
+			}
+			liked, err = db.GetLikedChirps(2, 2)
+			if err != nil || len(liked) != 1 {
+				t.Fatalf("got %+v, %v, want user 2 to see their like", liked, err)
+			}
+
+			quote, err := db.PostChirp(Chirp{Body: "look", AuthorId: 2, RefChirpId: 2, RefKind: RefQuote})
+			if err != nil {
+				t.Fatal(err)
+			}
+			refChirps, err := db.GetRefChirps([]Chirp{quote}, 3)
+			if err != nil || !refChirps[2].Hidden {
+				t.Fatalf("got %+v, %v, want the quoted chirp hidden from user 3", refChirps, err)
+			}
+
+			timeline, err := db.GetTimeline(2, ChirpQuery{ViewerId: 3})
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(timeline) != 4 || timeline[1].Id != 2 {
+				t.Fatalf("got timeline %+v, want chirps 1, 2 and those of user 2", timeline)
+			}
+		})
+	}
+}
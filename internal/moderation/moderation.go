@@ -0,0 +1,441 @@
+// Package moderation decides what happens to chirps that contain words
+// from a word list: each word is masked, gets the chirp rejected, or
+// gets it flagged for review.
+package moderation
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strings"
+	"unicode"
+)
+
+// Action is what a Rule does to a chirp containing its word
+type Action string
+
+const (
+	// ActionMask replaces the word with ****
+	ActionMask Action = "mask"
+	// ActionReject refuses the whole chirp
+	ActionReject Action = "reject"
+	// ActionFlag lets the chirp through as is but marks it for review
+	ActionFlag Action = "flag"
+)
+
+// Valid reports whether action is one of the known actions
+func (action Action) Valid() bool {
+	switch action {
+	case ActionMask, ActionReject, ActionFlag:
+		return true
+	}
+	return false
+}
+
+// Rule ties a word to the action taken when a chirp contains it
+type Rule struct {
+	Word   string `json:"word"`
+	Action Action `json:"action"`
+}
+
+// mask replaces every word masked in a chirp
+const mask = "****"
+
+// Verdict is the outcome of checking a chirp body against a Filter
+type Verdict struct {
+	// Body is the checked body with its masked words replaced
+	Body string
+	// Rejected holds the words the body is refused for, if any
+	Rejected []string
+	// Flagged holds the words the body should be reviewed for, if any
+	Flagged []string
+}
+
+// Filter checks chirp bodies against a word list. Words match whatever
+// their case, accents or the punctuation around them, and through
+// common obfuscations: digits and symbols standing in for letters
+// (f0rn4x), letters repeated (kerfuuuffle) and letters spelled out
+// one by one (f.o.r.n.a.x or f o r n a x). A Filter is immutable and
+// safe for concurrent use.
+type Filter struct {
+	rules []Rule
+	// patterns maps the letters of each word, with repeats collapsed,
+	// to the words they could be
+	patterns map[string][]pattern
+}
+
+// pattern is a normalized word as runs of the same letter
+type pattern struct {
+	counts []int
+	rule   Rule
+}
+
+// NewFilter compiles rules into a Filter. Every rule needs a word
+// without spaces or punctuation and a valid action. When a word
+// appears more than once the last rule for it wins.
+func NewFilter(rules []Rule) (*Filter, error) {
+	filter := &Filter{patterns: make(map[string][]pattern)}
+	byWord := make(map[string]int)
+	for _, rule := range rules {
+		if !rule.Action.Valid() {
+			return nil, fmt.Errorf("Unknown action %q for %q!", rule.Action, rule.Word)
+		}
+		if !isRuleWord(rule.Word) {
+			return nil, fmt.Errorf("%q must be a single word!", rule.Word)
+		}
+		word := string(normalize(rule.Word))
+		if i, ok := byWord[word]; ok {
+			filter.rules[i] = rule
+			continue
+		}
+		byWord[word] = len(filter.rules)
+		filter.rules = append(filter.rules, rule)
+	}
+	for _, rule := range filter.rules {
+		key, counts := runs(normalize(rule.Word))
+		filter.patterns[key] = append(filter.patterns[key], pattern{counts: counts, rule: rule})
+	}
+	return filter, nil
+}
+
+// ParseRules reads a word list, one word per line optionally followed
+// by its action, which defaults to mask. Blank lines and lines starting
+// with # are skipped.
+func ParseRules(r io.Reader) ([]Rule, error) {
+	rules := []Rule{}
+	scanner := bufio.NewScanner(r)
+	line := 0
+	for scanner.Scan() {
+		line++
+		fields := strings.Fields(scanner.Text())
+		if len(fields) == 0 || strings.HasPrefix(fields[0], "#") {
+			continue
+		}
+		rule := Rule{Word: fields[0], Action: ActionMask}
+		switch len(fields) {
+		case 1:
+		case 2:
+			rule.Action = Action(fields[1])
+		default:
+			return nil, fmt.Errorf("Line %d must hold a word and at most an action!", line)
+		}
+		if !rule.Action.Valid() {
+			return nil, fmt.Errorf("Unknown action %q on line %d!", rule.Action, line)
+		}
+		rules = append(rules, rule)
+	}
+	return rules, scanner.Err()
+}
+
+// LoadFile reads the word list at path
+func LoadFile(path string) ([]Rule, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+	rules, err := ParseRules(file)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	return rules, nil
+}
+
+// Rules returns the rules of the filter in the order they were given
+func (filter *Filter) Rules() []Rule {
+	return append([]Rule{}, filter.rules...)
+}
+
+// Check runs body through the filter
+func (filter *Filter) Check(body string) Verdict {
+	verdict := Verdict{}
+	var masked []token
+	for _, match := range filter.matches(body) {
+		switch match.rule.Action {
+		case ActionMask:
+			masked = append(masked, match.token)
+		case ActionReject:
+			verdict.Rejected = appendOnce(verdict.Rejected, match.rule.Word)
+		case ActionFlag:
+			verdict.Flagged = appendOnce(verdict.Flagged, match.rule.Word)
+		}
+	}
+	verdict.Body = maskTokens(body, masked)
+	return verdict
+}
+
+// Censor masks the words of body that are masked or rejected, for
+// chirps that were let through before their words were listed
+func (filter *Filter) Censor(body string) string {
+	var masked []token
+	for _, match := range filter.matches(body) {
+		if match.rule.Action != ActionFlag {
+			masked = append(masked, match.token)
+		}
+	}
+	return maskTokens(body, masked)
+}
+
+// maskTokens replaces the tokens of body, which are in order, with the mask
+func maskTokens(body string, tokens []token) string {
+	var builder strings.Builder
+	last := 0
+	for _, token := range tokens {
+		builder.WriteString(body[last:token.start])
+		builder.WriteString(mask)
+		last = token.end
+	}
+	builder.WriteString(body[last:])
+	return builder.String()
+}
+
+// match is a span of a body that one of the rules matched
+type match struct {
+	token
+	rule Rule
+}
+
+// matches finds the spans of body matching a rule, in order and
+// without overlaps. Words spelled out one letter at a time are tried
+// after the words as written.
+func (filter *Filter) matches(body string) []match {
+	tokens := tokenize(body)
+	var found []match
+	for _, token := range tokens {
+		if rule, ok := filter.lookup(body[token.start:token.end]); ok {
+			found = append(found, match{token: token, rule: rule})
+		}
+	}
+	for _, spelled := range spelledOut(body, tokens) {
+		if rule, ok := filter.lookup(spelled.text); ok {
+			found = append(found, match{token: spelled.token, rule: rule})
+		}
+	}
+	sort.SliceStable(found, func(i, j int) bool {
+		return found[i].start < found[j].start
+	})
+	kept := found[:0]
+	end := 0
+	for _, match := range found {
+		if match.start >= end {
+			kept = append(kept, match)
+			end = match.end
+		}
+	}
+	return kept
+}
+
+// lookup finds the rule matching word, which matches when it has the
+// same letters as the rule's word, each repeated at least as often
+func (filter *Filter) lookup(word string) (Rule, bool) {
+	key, counts := runs(normalize(word))
+	for _, pattern := range filter.patterns[key] {
+		if atLeast(counts, pattern.counts) {
+			return pattern.rule, true
+		}
+	}
+	return Rule{}, false
+}
+
+// token is a word of a body, as byte offsets into it
+type token struct {
+	start, end int
+}
+
+// tokenize splits text into words, which are runs of letters, digits,
+// combining marks and the symbols that stand in for letters. Symbols
+// only count inside a word, so the @ of a mention stays out of it.
+func tokenize(text string) []token {
+	var offsets []int
+	var inWord []bool
+	var symbol []bool
+	for i, r := range text {
+		offsets = append(offsets, i)
+		inWord = append(inWord, isWordRune(r))
+		symbol = append(symbol, isLeetSymbol(r))
+	}
+	offsets = append(offsets, len(text))
+	for i := 0; i < len(symbol); {
+		if !symbol[i] {
+			i++
+			continue
+		}
+		j := i
+		for j < len(symbol) && symbol[j] {
+			j++
+		}
+		inside := i > 0 && inWord[i-1] && j < len(symbol) && inWord[j]
+		for k := i; k < j; k++ {
+			inWord[k] = inside
+		}
+		i = j
+	}
+	var tokens []token
+	start := -1
+	for i := range inWord {
+		if inWord[i] {
+			if start < 0 {
+				start = i
+			}
+			continue
+		}
+		if start >= 0 {
+			tokens = append(tokens, token{start: offsets[start], end: offsets[i]})
+			start = -1
+		}
+	}
+	if start >= 0 {
+		tokens = append(tokens, token{start: offsets[start], end: len(text)})
+	}
+	return tokens
+}
+
+func isWordRune(r rune) bool {
+	return unicode.IsLetter(r) || unicode.IsDigit(r) || unicode.Is(unicode.Mn, r)
+}
+
+// isRuleWord reports whether word is fit for a rule. A rule word is
+// a word on its own, so symbols count anywhere in it.
+func isRuleWord(word string) bool {
+	for _, r := range word {
+		if !isWordRune(r) && !isLeetSymbol(r) {
+			return false
+		}
+	}
+	return word != ""
+}
+
+// isLeetSymbol reports whether r is a symbol that stands in for a letter
+func isLeetSymbol(r rune) bool {
+	_, ok := leet[r]
+	return ok && !isWordRune(r)
+}
+
+// spelledWord is a word spelled out one letter at a time
+type spelledWord struct {
+	token
+	text string
+}
+
+// spelledOut finds every run of at least three single letter tokens
+// separated by one character each, as in f.o.r.n.a.x, joined up
+func spelledOut(body string, tokens []token) []spelledWord {
+	var words []spelledWord
+	for i := range tokens {
+		text := ""
+		for j := i; j < len(tokens) && isSingleLetter(body[tokens[j].start:tokens[j].end]); j++ {
+			if j > i && !isSingleRune(body[tokens[j-1].end:tokens[j].start]) {
+				break
+			}
+			text += body[tokens[j].start:tokens[j].end]
+			if j-i >= 2 {
+				words = append(words, spelledWord{token: token{start: tokens[i].start, end: tokens[j].end}, text: text})
+			}
+		}
+	}
+	return words
+}
+
+// isSingleLetter reports whether word is one letter, possibly with
+// combining marks
+func isSingleLetter(word string) bool {
+	return len([]rune(normalize(word))) == 1
+}
+
+func isSingleRune(separator string) bool {
+	return len([]rune(separator)) == 1
+}
+
+// leet maps the digits and symbols commonly standing in for letters
+var leet = map[rune]rune{
+	'0': 'o',
+	'1': 'i',
+	'3': 'e',
+	'4': 'a',
+	'5': 's',
+	'7': 't',
+	'8': 'b',
+	'@': 'a',
+	'$': 's',
+}
+
+// accented maps the accented Latin letters to the letters underneath,
+// as combining accents are dropped anyway
+var accented = map[rune]rune{}
+
+func init() {
+	for letter, accents := range map[rune]string{
+		'a': "àáâãäåā",
+		'c': "çćč",
+		'e': "èéêëēěę",
+		'i': "ìíîïī",
+		'n': "ñńň",
+		'o': "òóôõöøō",
+		'r': "ř",
+		's': "śš",
+		'u': "ùúûüūů",
+		'y': "ýÿ",
+		'z': "źżž",
+	} {
+		for _, r := range accents {
+			accented[r] = letter
+		}
+	}
+}
+
+// normalize lowercases word, replaces stand ins and accented letters
+// with the letters they stand for and drops combining marks
+func normalize(word string) []rune {
+	normalized := make([]rune, 0, len(word))
+	for _, r := range word {
+		if unicode.Is(unicode.Mn, r) {
+			continue
+		}
+		r = unicode.ToLower(r)
+		if letter, ok := leet[r]; ok {
+			r = letter
+		}
+		if letter, ok := accented[r]; ok {
+			r = letter
+		}
+		normalized = append(normalized, r)
+	}
+	return normalized
+}
+
+// runs collapses repeated letters in word, returning the collapsed
+// word and how often each of its letters was repeated
+func runs(word []rune) (string, []int) {
+	var collapsed []rune
+	var counts []int
+	for i, r := range word {
+		if i > 0 && r == word[i-1] {
+			counts[len(counts)-1]++
+			continue
+		}
+		collapsed = append(collapsed, r)
+		counts = append(counts, 1)
+	}
+	return string(collapsed), counts
+}
+
+// atLeast reports whether every count is at least its minimum
+func atLeast(counts, minimums []int) bool {
+	for i := range counts {
+		if counts[i] < minimums[i] {
+			return false
+		}
+	}
+	return true
+}
+
+func appendOnce(words []string, word string) []string {
+	for _, w := range words {
+		if w == word {
+			return words
+		}
+	}
+	return append(words, word)
+}
@@ -0,0 +1,121 @@
+package moderation
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestCheck(t *testing.T) {
+	filter, err := NewFilter([]Rule{
+		{Word: "kerfuffle", Action: ActionMask},
+		{Word: "sharbert", Action: ActionMask},
+		{Word: "fornax", Action: ActionMask},
+		{Word: "heisenberg", Action: ActionReject},
+		{Word: "pinkman", Action: ActionFlag},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		body string
+		want Verdict
+	}{
+		{"This is a kerfuffle opinion I need to share with the world", Verdict{Body: "This is a **** opinion I need to share with the world"}},
+		{"Kerfuffle! What a fornax, sharbert.", Verdict{Body: "****! What a ****, ****."}},
+		{"KERFUFFLE and \"fornax\"", Verdict{Body: "**** and \"****\""}},
+		{"f0rn4x and sh@rb3rt", Verdict{Body: "**** and ****"}},
+		{"@fornax, $kerfuffle$ and k3rfu$$le", Verdict{Body: "@****, $****$ and k3rfu$$le"}},
+		{"kerfuuuffle and forrrnax", Verdict{Body: "**** and ****"}},
+		{"f.o.r.n.a.x and f o r n a x!", Verdict{Body: "**** and ****!"}},
+		{"Fórnax and fórnax", Verdict{Body: "**** and ****"}},
+		{"kerfufle and fornaxes are fine", Verdict{Body: "kerfufle and fornaxes are fine"}},
+		{"Say my name: Heisenberg", Verdict{Body: "Say my name: Heisenberg", Rejected: []string{"heisenberg"}}},
+		{"Yo, Pinkman, pinkman!", Verdict{Body: "Yo, Pinkman, pinkman!", Flagged: []string{"pinkman"}}},
+		{"Pinkman, the fornax", Verdict{Body: "Pinkman, the ****", Flagged: []string{"pinkman"}}},
+		{"", Verdict{Body: ""}},
+	}
+	for _, test := range tests {
+		got := filter.Check(test.body)
+		if !reflect.DeepEqual(got, test.want) {
+			t.Errorf("%q: got %+v, want %+v", test.body, got, test.want)
+		}
+	}
+}
+
+func TestCensor(t *testing.T) {
+	filter, err := NewFilter([]Rule{
+		{Word: "fornax", Action: ActionMask},
+		{Word: "heisenberg", Action: ActionReject},
+		{Word: "pinkman", Action: ActionFlag},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	got := filter.Censor("Heisenberg, Pinkman and the f0rnax")
+	want := "****, Pinkman and the ****"
+	if got != want {
+		t.Fatalf("got %q, want %q", got, want)
+	}
+}
+
+func TestNewFilter(t *testing.T) {
+	tests := []struct {
+		rules   []Rule
+		wantErr bool
+	}{
+		{[]Rule{{Word: "kerfuffle", Action: ActionMask}, {Word: "fornax", Action: ActionFlag}}, false},
+		{[]Rule{{Word: "fornax", Action: "ban"}}, true},
+		{[]Rule{{Word: "", Action: ActionMask}}, true},
+		{[]Rule{{Word: "two words", Action: ActionMask}}, true},
+		{[]Rule{{Word: "fornax!", Action: ActionMask}}, true},
+		{[]Rule{{Word: "$harbert", Action: ActionMask}}, false},
+	}
+	for _, test := range tests {
+		_, err := NewFilter(test.rules)
+		if (err != nil) != test.wantErr {
+			t.Errorf("%+v: got %v, want an error: %t", test.rules, err, test.wantErr)
+		}
+	}
+
+	// The last rule for a word wins.
+	filter, err := NewFilter([]Rule{
+		{Word: "fornax", Action: ActionMask},
+		{Word: "sharbert", Action: ActionMask},
+		{Word: "Fornax", Action: ActionReject},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []Rule{{Word: "Fornax", Action: ActionReject}, {Word: "sharbert", Action: ActionMask}}
+	if !reflect.DeepEqual(filter.Rules(), want) {
+		t.Fatalf("got %+v, want %+v", filter.Rules(), want)
+	}
+}
+
+func TestParseRules(t *testing.T) {
+	tests := []struct {
+		list    string
+		want    []Rule
+		wantErr bool
+	}{
+		{"# Words\nkerfuffle\n\nfornax reject\n  sharbert   flag  \n", []Rule{
+			{Word: "kerfuffle", Action: ActionMask},
+			{Word: "fornax", Action: ActionReject},
+			{Word: "sharbert", Action: ActionFlag},
+		}, false},
+		{"", []Rule{}, false},
+		{"fornax ban\n", nil, true},
+		{"fornax mask twice\n", nil, true},
+	}
+	for _, test := range tests {
+		rules, err := ParseRules(strings.NewReader(test.list))
+		if (err != nil) != test.wantErr {
+			t.Errorf("%q: got %v, want an error: %t", test.list, err, test.wantErr)
+			continue
+		}
+		if !test.wantErr && !reflect.DeepEqual(rules, test.want) {
+			t.Errorf("%q: got %+v, want %+v", test.list, rules, test.want)
+		}
+	}
+}
@@ -0,0 +1,29 @@
+package main
+
+import (
+	"context"
+	"log"
+	"time"
+)
+
+// runTokenJanitor periodically removes revocations of refresh tokens
+// that have expired since, they can't be used either way
+func (cfg *apiConfig) runTokenJanitor(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			pruned, err := cfg.db.PruneRevokedTokens(time.Now())
+			if err != nil {
+				log.Printf("Error pruning revoked tokens: %s", err)
+				continue
+			}
+			if pruned > 0 {
+				log.Printf("Pruned %d expired revoked tokens", pruned)
+			}
+		case <-ctx.Done():
+			return
+		}
+	}
+}
@@ -0,0 +1,77 @@
+package main
+
+import (
+	"log"
+	"net/http"
+
+	"github.com/go-chi/chi/v5"
+)
+
+// handlerPostLike likes a chirp on behalf of the user, answering
+// with its likes. Liking a chirp twice counts once.
+func (cfg *apiConfig) handlerPostLike(w http.ResponseWriter, r *http.Request) {
+	userId, err := cfg.authenticate(r)
+	if err != nil {
+		log.Print(err.Error())
+		respondWithError(w, 401, "Unauthorized!")
+		return
+	}
+	chirp, err := cfg.resolveVisibleChirp(chi.URLParam(r, "id"), userId)
+	if err != nil {
+		respondWithDBError(w, err)
+		return
+	}
+	likes, err := cfg.db.LikeChirp(userId, chirp.Id)
+	if err != nil {
+		respondWithDBError(w, err)
+		return
+	}
+	respondWithJSON(w, 200, likes)
+}
+
+// handlerDeleteLike takes back the user's like of a chirp
+func (cfg *apiConfig) handlerDeleteLike(w http.ResponseWriter, r *http.Request) {
+	userId, err := cfg.authenticate(r)
+	if err != nil {
+		log.Print(err.Error())
+		respondWithError(w, 401, "Unauthorized!")
+		return
+	}
+	chirp, err := cfg.resolveVisibleChirp(chi.URLParam(r, "id"), userId)
+	if err != nil {
+		respondWithDBError(w, err)
+		return
+	}
+	likes, err := cfg.db.UnlikeChirp(userId, chirp.Id)
+	if err != nil {
+		respondWithDBError(w, err)
+		return
+	}
+	respondWithJSON(w, 200, likes)
+}
+
+// handlerGetUserLikes lists the chirps a user liked, most recently liked first
+func (cfg *apiConfig) handlerGetUserLikes(w http.ResponseWriter, r *http.Request) {
+	viewerId, err := cfg.authenticateOptional(r)
+	if err != nil {
+		log.Print(err.Error())
+		respondWithError(w, 401, "Unauthorized!")
+		return
+	}
+	userId, err := userIdParam(r)
+	if err != nil {
+		respondWithError(w, 400, "Invalid user id!")
+		return
+	}
+	chirps, err := cfg.db.GetLikedChirps(userId, viewerId)
+	if err != nil {
+		respondWithDBError(w, err)
+		return
+	}
+	response, err := cfg.renderChirps(chirps, viewerId)
+	if err != nil {
+		respondWithDBError(w, err)
+		return
+	}
+	respondWithJSON(w, 200, response)
+}
@@ -1,12 +1,20 @@
 package main
 
 import (
+	"context"
 	"flag"
 	"fmt"
 	"log"
 	"net/http"
 	"os"
+	"os/signal"
+	"sync"
+	"sync/atomic"
+	"syscall"
+	"time"
 
+	"github.com/aliasboink/go_web_server/internal/database"
+	"github.com/aliasboink/go_web_server/internal/moderation"
 	"github.com/go-chi/chi/v5"
 	"github.com/joho/godotenv"
 )
@@ -15,6 +23,14 @@ type apiConfig struct {
 	fileserverHits int
 	jwtSecret      string
 	polkaSecret    string
+	adminSecret    string
+	backupDir      string
+	dbConfig       database.Config
+	db             database.Store
+	// filter is swapped out whenever the profanity list changes,
+	// profanityMux keeps changes and their reloads in order
+	filter       atomic.Pointer[moderation.Filter]
+	profanityMux sync.Mutex
 }
 
 func main() {
@@ -27,16 +43,80 @@ func main() {
 	const filepathRoot = "."
 	const port = "8080"
 
+	// DB_DRIVER is either "json" (the default) or "sqlite"
+	dbDriver := os.Getenv("DB_DRIVER")
+	if dbDriver == "" {
+		dbDriver = "json"
+	}
+	dbPath := os.Getenv("DB_PATH")
+	if dbPath == "" {
+		dbPath = "database.json"
+		if dbDriver == "sqlite" {
+			dbPath = "database.sqlite"
+		}
+	}
+
+	var flushInterval time.Duration
+	if interval := os.Getenv("DB_FLUSH_INTERVAL"); interval != "" {
+		var err error
+		flushInterval, err = time.ParseDuration(interval)
+		if err != nil {
+			log.Fatal(err)
+		}
+	}
+	dbConfig := database.Config{
+		Driver:        dbDriver,
+		Path:          dbPath,
+		Journal:       os.Getenv("DB_JOURNAL") == "true",
+		FlushInterval: flushInterval,
+		// DB_ID_SCHEME is "sequence" (the default), "ulid" or "uuidv7"
+		IdScheme: os.Getenv("DB_ID_SCHEME"),
+	}
+
+	tokenPruneInterval := time.Hour
+	if interval := os.Getenv("TOKEN_PRUNE_INTERVAL"); interval != "" {
+		var err error
+		tokenPruneInterval, err = time.ParseDuration(interval)
+		if err != nil {
+			log.Fatal(err)
+		}
+	}
+
+	backupDir := os.Getenv("BACKUP_DIR")
+	if backupDir == "" {
+		backupDir = "backups"
+	}
+
 	debug := flag.Bool("debug", false, "Debug the program (deletes DB).")
 	flag.Parse()
 	if *debug {
-		deleteDatabase("database.json")
+		deleteDatabase(dbPath)
+	}
+	if flag.NArg() > 0 {
+		err := runCommand(dbConfig, flag.Args())
+		if err != nil {
+			log.Fatal(err)
+		}
+		return
+	}
+
+	db, err := database.Open(dbConfig)
+	if err != nil {
+		log.Fatal(err)
 	}
 
 	apiCfg := apiConfig{
 		fileserverHits: 0,
 		jwtSecret:      os.Getenv("JWT_SECRET"),
 		polkaSecret:    os.Getenv("POLKA_SECRET"),
+		adminSecret:    os.Getenv("ADMIN_SECRET"),
+		backupDir:      backupDir,
+		dbConfig:       dbConfig,
+		db:             db,
+	}
+	err = apiCfg.reloadFilter()
+	if err != nil {
+		log.Fatal(err)
 	}
 
 	r.Handle("/app", apiCfg.middlewareMetricsInc(http.StripPrefix("/app", http.FileServer(http.Dir(filepathRoot)))))
@@ -44,16 +124,49 @@ func main() {
 	apiRouter.Get("/healthz", handlerReadiness)
 	apiRouter.Get("/reset", apiCfg.handlerReset)
 	apiRouter.Post("/chirps", apiCfg.handlerPostChirp)
-	apiRouter.Get("/chirps", handlerGetChirps)
-	apiRouter.Get("/chirps/{id}", handlerGetChirpWithId)
+	apiRouter.Get("/chirps", apiCfg.handlerGetChirps)
+	apiRouter.Get("/chirps/{id}", apiCfg.handlerGetChirpWithId)
 	apiRouter.Delete("/chirps/{id}", apiCfg.handlerDeleteChirp)
-	apiRouter.Post("/users", handlerPostUser)
+	apiRouter.Put("/chirps/{id}", apiCfg.handlerPutChirp)
+	apiRouter.Patch("/chirps/{id}", apiCfg.handlerPutChirp)
+	apiRouter.Get("/chirps/{id}/history", apiCfg.handlerGetChirpHistory)
+	apiRouter.Get("/chirps/{id}/thread", apiCfg.handlerGetChirpThread)
+	apiRouter.Post("/chirps/{id}/like", apiCfg.handlerPostLike)
+	apiRouter.Delete("/chirps/{id}/like", apiCfg.handlerDeleteLike)
+	apiRouter.Post("/chirps/{id}/rechirp", apiCfg.handlerPostRechirp)
+	apiRouter.Post("/chirps/{id}/report", apiCfg.handlerPostReport)
+	apiRouter.Get("/reports", apiCfg.handlerGetReports)
+	apiRouter.Post("/users", apiCfg.handlerPostUser)
 	apiRouter.Put("/users", apiCfg.handlerPutUsers)
+	apiRouter.Get("/users/{id}/likes", apiCfg.handlerGetUserLikes)
+	apiRouter.Post("/users/{id}/follow", apiCfg.handlerPostFollow)
+	apiRouter.Delete("/users/{id}/follow", apiCfg.handlerDeleteFollow)
+	apiRouter.Get("/users/{id}/followers", apiCfg.handlerGetFollowers)
+	apiRouter.Get("/users/{id}/following", apiCfg.handlerGetFollowing)
+	apiRouter.Post("/users/{id}/block", apiCfg.handlerPostBlock)
+	apiRouter.Delete("/users/{id}/block", apiCfg.handlerDeleteBlock)
+	apiRouter.Post("/users/{id}/mute", apiCfg.handlerPostMute)
+	apiRouter.Delete("/users/{id}/mute", apiCfg.handlerDeleteMute)
+	apiRouter.Get("/users/{id}/mentions", apiCfg.handlerGetUserMentions)
+	apiRouter.Get("/timeline", apiCfg.handlerGetTimeline)
+	apiRouter.Get("/hashtags/{tag}/chirps", apiCfg.handlerGetHashtagChirps)
+	apiRouter.Get("/search/chirps", apiCfg.handlerGetSearchChirps)
 	apiRouter.Post("/login", apiCfg.handlerPostLogin)
 	apiRouter.Post("/revoke", apiCfg.handlerPostRevoke)
 	apiRouter.Post("/refresh", apiCfg.handlerPostRefresh)
 	apiRouter.Post("/polka/webhooks", apiCfg.handlerPostPolkaWebhook)
 	adminRouter.Get("/metrics", apiCfg.handlerMetrics)
+	adminRouter.Group(func(r chi.Router) {
+		r.Use(apiCfg.middlewareAdminAuth)
+		r.Get("/snapshot", apiCfg.handlerGetSnapshot)
+		r.Post("/snapshot", apiCfg.handlerPostSnapshot)
+		r.Get("/profanities", apiCfg.handlerGetProfanities)
+		r.Post("/profanities", apiCfg.handlerPostProfanity)
+		r.Delete("/profanities/{word}", apiCfg.handlerDeleteProfanity)
+		r.Post("/profanities/recensor", apiCfg.handlerPostRecensor)
+		r.Get("/moderation", apiCfg.handlerGetModeration)
+		r.Post("/moderation/{id}", apiCfg.handlerPostModeration)
+	})
 
 	r.Mount("/api", apiRouter)
 	r.Mount("/admin", adminRouter)
@@ -65,14 +178,37 @@ func main() {
 		Handler: corsMux,
 	}
 
+	// Shut down cleanly on Ctrl+C so batched writes reach the disk.
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+	go apiCfg.runTokenJanitor(ctx, tokenPruneInterval)
+	go func() {
+		<-ctx.Done()
+		srv.Shutdown(context.Background())
+	}()
+
 	log.Printf("Serving files from %s on port: %s\n", filepathRoot, port)
-	log.Fatal(srv.ListenAndServe())
+	err = srv.ListenAndServe()
+	if err != nil && err != http.ErrServerClosed {
+		log.Fatal(err)
+	}
+	err = db.Close()
+	if err != nil {
+		log.Fatal(err)
+	}
 }
 
 func (cfg *apiConfig) handlerMetrics(w http.ResponseWriter, r *http.Request) {
 	w.Header().Add("Content-Type", "text/html; charset=utf-8")
 	w.WriteHeader(http.StatusOK)
-	myMap := map[string]interface{}{"Hits": fmt.Sprintf("%d", cfg.fileserverHits)}
+	revokedTokens, err := cfg.db.CountRevokedTokens()
+	if err != nil {
+		log.Print(err.Error())
+	}
+	myMap := map[string]interface{}{
+		"Hits":          fmt.Sprintf("%d", cfg.fileserverHits),
+		"RevokedTokens": fmt.Sprintf("%d", revokedTokens),
+	}
 	outputHTML(w, "admin/metrics.html", myMap)
 }
 
@@ -0,0 +1,129 @@
+package main
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+	"time"
+
+	"github.com/aliasboink/go_web_server/internal/database"
+)
+
+// maxPageLimit caps the limit query parameter
+const maxPageLimit = 100
+
+// defaultPageLimit is the limit of pages that are always paged
+const defaultPageLimit = 20
+
+// pageCursor is what an opaque cursor encodes: the
+// last chirp of the previous page
+type pageCursor struct {
+	CreatedAt time.Time `json:"created_at"`
+	Id        int       `json:"id"`
+}
+
+func encodeCursor(cursor pageCursor) string {
+	cursorBytes, _ := json.Marshal(cursor)
+	return base64.RawURLEncoding.EncodeToString(cursorBytes)
+}
+
+func decodeCursor(s string) (pageCursor, error) {
+	cursorBytes, err := base64.RawURLEncoding.DecodeString(s)
+	if err != nil {
+		return pageCursor{}, err
+	}
+	var cursor pageCursor
+	err = json.Unmarshal(cursorBytes, &cursor)
+	if err != nil {
+		return pageCursor{}, err
+	}
+	if cursor.Id < 1 {
+		return pageCursor{}, errors.New("Invalid cursor!")
+	}
+	return cursor, nil
+}
+
+// parseLimit reads the limit query parameter, 0 if it is absent
+func parseLimit(query url.Values) (int, error) {
+	limit := query.Get("limit")
+	if limit == "" {
+		return 0, nil
+	}
+	limitInt, err := strconv.Atoi(limit)
+	if err != nil || limitInt < 1 || limitInt > maxPageLimit {
+		return 0, fmt.Errorf("Limit must be between 1 and %d!", maxPageLimit)
+	}
+	return limitInt, nil
+}
+
+// parseTime reads an RFC 3339 time from the query parameter name,
+// the zero time if it is absent
+func parseTime(query url.Values, name string) (time.Time, error) {
+	value := query.Get(name)
+	if value == "" {
+		return time.Time{}, nil
+	}
+	t, err := time.Parse(time.RFC3339, value)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("%s must be an RFC 3339 time!", name)
+	}
+	return t, nil
+}
+
+// setNextLink points a Link header at the page after cursor,
+// keeping the other query parameters of r
+func setNextLink(w http.ResponseWriter, r *http.Request, cursor pageCursor) {
+	query := r.URL.Query()
+	query.Set("cursor", encodeCursor(cursor))
+	next := url.URL{Path: r.URL.Path, RawQuery: query.Encode()}
+	w.Header().Set("Link", fmt.Sprintf("<%s>; rel=\"next\"", next.String()))
+}
+
+// parseChirpPage fills in the since, until and cursor query parameters
+// of a chirp listing and returns its limit, setting query.Limit to one
+// more so the caller can tell whether there is a next page
+func parseChirpPage(values url.Values, query *database.ChirpQuery) (int, error) {
+	var err error
+	query.Since, err = parseTime(values, "since")
+	if err != nil {
+		return 0, err
+	}
+	query.Until, err = parseTime(values, "until")
+	if err != nil {
+		return 0, err
+	}
+	limit, err := parseLimit(values)
+	if err != nil {
+		return 0, err
+	}
+	if cursor := values.Get("cursor"); cursor != "" {
+		decoded, err := decodeCursor(cursor)
+		if err != nil {
+			return 0, errors.New("Invalid cursor!")
+		}
+		query.After = database.Chirp{Id: decoded.Id, CreatedAt: decoded.CreatedAt}
+	}
+	if limit > 0 {
+		query.Limit = limit + 1
+	}
+	return limit, nil
+}
+
+// parseFeedPage is parseChirpPage for listings that are always
+// newest first and always paged
+func parseFeedPage(values url.Values) (database.ChirpQuery, int, error) {
+	query := database.ChirpQuery{Desc: true}
+	limit, err := parseChirpPage(values, &query)
+	if err != nil {
+		return database.ChirpQuery{}, 0, err
+	}
+	if limit == 0 {
+		limit = defaultPageLimit
+		query.Limit = limit + 1
+	}
+	return query, limit, nil
+}
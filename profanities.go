@@ -0,0 +1,115 @@
+package main
+
+import (
+	"encoding/json"
+	"log"
+	"net/http"
+
+	"github.com/aliasboink/go_web_server/internal/moderation"
+	"github.com/go-chi/chi/v5"
+)
+
+// reloadFilter compiles the profanity list in the database into the
+// filter new chirps go through
+func (cfg *apiConfig) reloadFilter() error {
+	words, err := cfg.db.GetBannedWords()
+	if err != nil {
+		return err
+	}
+	rules := make([]moderation.Rule, len(words))
+	for i, word := range words {
+		rules[i] = moderation.Rule{Word: word.Word, Action: moderation.Action(word.Action)}
+	}
+	filter, err := moderation.NewFilter(rules)
+	if err != nil {
+		return err
+	}
+	cfg.filter.Store(filter)
+	return nil
+}
+
+// handlerGetProfanities lists the profanity list, alphabetically
+func (cfg *apiConfig) handlerGetProfanities(w http.ResponseWriter, r *http.Request) {
+	words, err := cfg.db.GetBannedWords()
+	if err != nil {
+		respondWithDBError(w, err)
+		return
+	}
+	respondWithJSON(w, 200, words)
+}
+
+// handlerPostProfanity adds a word to the profanity list, or changes
+// its action, taking effect for the next chirp
+func (cfg *apiConfig) handlerPostProfanity(w http.ResponseWriter, r *http.Request) {
+	type parameters struct {
+		Word   string            `json:"word"`
+		Action moderation.Action `json:"action"`
+	}
+	decoder := json.NewDecoder(r.Body)
+	params := parameters{}
+	err := decoder.Decode(&params)
+	if err != nil {
+		respondWithError(w, 500, "Something went wrong!")
+		return
+	}
+	if params.Action == "" {
+		params.Action = moderation.ActionMask
+	}
+	_, err = moderation.NewFilter([]moderation.Rule{{Word: params.Word, Action: params.Action}})
+	if err != nil {
+		respondWithError(w, 400, err.Error())
+		return
+	}
+	cfg.profanityMux.Lock()
+	defer cfg.profanityMux.Unlock()
+	word, err := cfg.db.AddBannedWord(params.Word, string(params.Action))
+	if err != nil {
+		respondWithDBError(w, err)
+		return
+	}
+	err = cfg.reloadFilter()
+	if err != nil {
+		respondWithDBError(w, err)
+		return
+	}
+	respondWithJSON(w, 201, word)
+}
+
+// handlerDeleteProfanity takes a word off the profanity list. Chirps
+// it was masked in stay masked.
+func (cfg *apiConfig) handlerDeleteProfanity(w http.ResponseWriter, r *http.Request) {
+	cfg.profanityMux.Lock()
+	defer cfg.profanityMux.Unlock()
+	err := cfg.db.RemoveBannedWord(chi.URLParam(r, "word"))
+	if err != nil {
+		respondWithDBError(w, err)
+		return
+	}
+	err = cfg.reloadFilter()
+	if err != nil {
+		respondWithDBError(w, err)
+		return
+	}
+	w.WriteHeader(204)
+}
+
+// handlerPostRecensor runs every existing chirp through the current
+// profanity list, masking the words that are masked or rejected. The
+// list can't change until the pass is done.
+func (cfg *apiConfig) handlerPostRecensor(w http.ResponseWriter, r *http.Request) {
+	cfg.profanityMux.Lock()
+	defer cfg.profanityMux.Unlock()
+	filter := cfg.filter.Load()
+	censored, err := cfg.db.CensorChirps(filter.Censor)
+	if err != nil {
+		respondWithDBError(w, err)
+		return
+	}
+	log.Printf("Re-censored %d chirps", censored)
+	response := struct {
+		Censored int `json:"censored"`
+	}{
+		Censored: censored,
+	}
+	respondWithJSON(w, 200, response)
+}
@@ -0,0 +1,176 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/aliasboink/go_web_server/internal/database"
+	"github.com/go-chi/chi/v5"
+)
+
+// flagChirp files a report for the moderators on a chirp that
+// contains words the profanity filter flags
+func (cfg *apiConfig) flagChirp(chirp database.Chirp, flagged []string) {
+	if len(flagged) == 0 {
+		return
+	}
+	_, err := cfg.db.ReportChirp(database.Report{
+		ChirpId: chirp.Id,
+		Reason:  fmt.Sprintf("Flagged words: %s", strings.Join(flagged, ", ")),
+	})
+	// An edit may be flagged again before the first report is decided.
+	if err != nil && !errors.Is(err, database.ErrReported) {
+		log.Print(err.Error())
+	}
+}
+
+// handlerPostReport reports a chirp to the moderators
+func (cfg *apiConfig) handlerPostReport(w http.ResponseWriter, r *http.Request) {
+	userId, err := cfg.authenticate(r)
+	if err != nil {
+		log.Print(err.Error())
+		respondWithError(w, 401, "Unauthorized!")
+		return
+	}
+	type parameters struct {
+		Reason string `json:"reason"`
+	}
+	decoder := json.NewDecoder(r.Body)
+	params := parameters{}
+	err = decoder.Decode(&params)
+	if err != nil {
+		respondWithError(w, 500, "Something went wrong!")
+		return
+	}
+	params.Reason = strings.TrimSpace(params.Reason)
+	if params.Reason == "" {
+		respondWithError(w, 400, "A report needs a reason!")
+		return
+	}
+	if len(params.Reason) > 500 {
+		respondWithError(w, 400, "Reason is too long!")
+		return
+	}
+	chirp, err := cfg.resolveVisibleChirp(chi.URLParam(r, "id"), userId)
+	if err != nil {
+		respondWithDBError(w, err)
+		return
+	}
+	report, err := cfg.db.ReportChirp(database.Report{ChirpId: chirp.Id, ReporterId: userId, Reason: params.Reason})
+	if err != nil {
+		respondWithDBError(w, err)
+		return
+	}
+	respondWithJSON(w, 201, report)
+}
+
+// handlerGetReports lists the reports the user filed, newest first,
+// with what the moderators decided on them
+func (cfg *apiConfig) handlerGetReports(w http.ResponseWriter, r *http.Request) {
+	userId, err := cfg.authenticate(r)
+	if err != nil {
+		log.Print(err.Error())
+		respondWithError(w, 401, "Unauthorized!")
+		return
+	}
+	reports, err := cfg.db.GetReportsBy(userId)
+	if err != nil {
+		respondWithDBError(w, err)
+		return
+	}
+	respondWithJSON(w, 200, reports)
+}
+
+// moderationItem is a report in the moderation queue together with the
+// chirp it is about, hidden or not, unless the chirp is gone
+type moderationItem struct {
+	database.Report
+	Chirp *database.Chirp `json:"chirp,omitempty"`
+}
+
+// handlerGetModeration lists the reports with status, open ones by
+// default, oldest first
+func (cfg *apiConfig) handlerGetModeration(w http.ResponseWriter, r *http.Request) {
+	status := r.URL.Query().Get("status")
+	switch status {
+	case "":
+		status = database.ReportOpen
+	case "all":
+		status = ""
+	case database.ReportOpen, database.ReportDismissed, database.ReportHidden, database.ReportDeleted:
+	default:
+		respondWithError(w, 400, "Invalid status!")
+		return
+	}
+	var items []moderationItem
+	err := cfg.db.View(func(tx database.Tx) error {
+		reports, err := tx.GetReportsByStatus(status)
+		if err != nil {
+			return err
+		}
+		items = make([]moderationItem, len(reports))
+		for i, report := range reports {
+			items[i].Report = report
+			chirp, err := tx.GetThreadChirp(report.ChirpId)
+			if errors.Is(err, database.ErrNotFound) || chirp.Deleted {
+				continue
+			}
+			if err != nil {
+				return err
+			}
+			items[i].Chirp = &chirp
+		}
+		return nil
+	})
+	if err != nil {
+		respondWithDBError(w, err)
+		return
+	}
+	respondWithJSON(w, 200, items)
+}
+
+// decisions maps what a moderator can decide to the
+// status of the reports it resolves
+var decisions = map[string]string{
+	"dismiss": database.ReportDismissed,
+	"hide":    database.ReportHidden,
+	"delete":  database.ReportDeleted,
+}
+
+// handlerPostModeration records the decision on an open report,
+// dismissing it or hiding or deleting the chirp, for every open
+// report on the same chirp
+func (cfg *apiConfig) handlerPostModeration(w http.ResponseWriter, r *http.Request) {
+	reportId, err := strconv.Atoi(chi.URLParam(r, "id"))
+	if err != nil {
+		respondWithError(w, 400, "Invalid report id!")
+		return
+	}
+	type parameters struct {
+		Decision string `json:"decision"`
+		Note     string `json:"note"`
+	}
+	decoder := json.NewDecoder(r.Body)
+	params := parameters{}
+	err = decoder.Decode(&params)
+	if err != nil {
+		respondWithError(w, 500, "Something went wrong!")
+		return
+	}
+	status, ok := decisions[params.Decision]
+	if !ok {
+		respondWithError(w, 400, "Decision must be dismiss, hide or delete!")
+		return
+	}
+	report, err := cfg.db.ResolveReport(reportId, status, params.Note)
+	if err != nil {
+		respondWithDBError(w, err)
+		return
+	}
+	respondWithJSON(w, 200, report)
+}
@@ -0,0 +1,52 @@
+package main
+
+import (
+	"log"
+	"net/http"
+	"strconv"
+
+	"github.com/aliasboink/go_web_server/internal/database"
+)
+
+// handlerGetSearchChirps lists the chirps with all the words in q, most
+// relevant first, optionally only those by author_id and at most limit
+func (cfg *apiConfig) handlerGetSearchChirps(w http.ResponseWriter, r *http.Request) {
+	userId, err := cfg.authenticateOptional(r)
+	if err != nil {
+		log.Print(err.Error())
+		respondWithError(w, 401, "Unauthorized!")
+		return
+	}
+	query := database.SearchQuery{Text: r.URL.Query().Get("q"), ViewerId: userId}
+	if query.Text == "" {
+		respondWithError(w, 400, "Missing search query!")
+		return
+	}
+	authorId := r.URL.Query().Get("author_id")
+	if authorId != "" {
+		query.AuthorId, err = strconv.Atoi(authorId)
+		if err != nil {
+			respondWithError(w, 400, "Invalid author id!")
+			return
+		}
+	}
+	query.Limit, err = parseLimit(r.URL.Query())
+	if err != nil {
+		respondWithError(w, 400, err.Error())
+		return
+	}
+	if query.Limit == 0 {
+		query.Limit = defaultPageLimit
+	}
+	chirps, err := cfg.db.SearchChirps(query)
+	if err != nil {
+		respondWithDBError(w, err)
+		return
+	}
+	response, err := cfg.renderChirps(chirps, userId)
+	if err != nil {
+		respondWithDBError(w, err)
+		return
+	}
+	respondWithJSON(w, 200, response)
+}
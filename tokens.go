@@ -1,6 +1,7 @@
 package main
 
 import (
+	"errors"
 	"log"
 	"net/http"
 	"strings"
@@ -12,16 +13,28 @@ import (
 
 func (cfg *apiConfig) handlerPostRevoke(w http.ResponseWriter, r *http.Request) {
 	tokenString := strings.TrimPrefix(r.Header.Get("Authorization"), "Bearer ")
-	db, err := database.NewDB("database.json")
+	claims := jwt.RegisteredClaims{}
+	_, err := jwt.ParseWithClaims(tokenString, &claims, func(token *jwt.Token) (interface{}, error) {
+		return []byte(cfg.jwtSecret), nil
+	})
+	// An expired token can't be used anymore, nothing to revoke.
+	if errors.Is(err, jwt.ErrTokenExpired) {
+		w.WriteHeader(200)
+		return
+	}
 	if err != nil {
 		log.Print(err.Error())
-		respondWithError(w, 500, "Something went wrong with the DB!")
+		respondWithError(w, 401, "Unauthorized!")
 		return
 	}
-	err = db.RevokeToken(tokenString)
+	expiresAt, err := claims.GetExpirationTime()
+	if err != nil || expiresAt == nil {
+		respondWithError(w, 401, "Unauthorized!")
+		return
+	}
+	err = cfg.db.RevokeToken(tokenString, expiresAt.Time)
 	if err != nil {
-		log.Print(err.Error())
-		respondWithError(w, 500, "Something went wrong with the DB!")
+		respondWithDBError(w, err)
 		return
 	}
 	w.WriteHeader(200)
@@ -45,16 +58,13 @@ func (cfg *apiConfig) handlerPostRefresh(w http.ResponseWriter, r *http.Request)
 		respondWithError(w, 401, "Unauthorized!")
 		return
 	}
-	db, err := database.NewDB("database.json")
-	if err != nil {
-		log.Print(err.Error())
-		respondWithError(w, 500, "Something went wrong with the DB!")
+	err = cfg.db.CheckRevocation(tokenString)
+	if errors.Is(err, database.ErrRevoked) {
+		respondWithError(w, 401, "Unauthorized!")
 		return
 	}
-	err = db.CheckRevocation(tokenString)
 	if err != nil {
-		log.Print(err.Error())
-		respondWithError(w, 401, "Unauthorized!")
+		respondWithDBError(w, err)
 		return
 	}
 	// Create Access JWT Token
@@ -2,6 +2,7 @@ package main
 
 import (
 	"encoding/json"
+	"errors"
 	"fmt"
 	"log"
 	"net/http"
@@ -10,9 +11,8 @@ import (
 	"strings"
 	"time"
 
-	"github.com/golang-jwt/jwt/v5"
-
 	"github.com/aliasboink/go_web_server/internal/database"
+	"github.com/golang-jwt/jwt/v5"
 	"golang.org/x/crypto/bcrypt"
 )
 
@@ -38,69 +38,68 @@ func (cfg *apiConfig) handlerPostLogin(w http.ResponseWriter, r *http.Request) {
 		respondWithError(w, 422, "Invalid email!")
 		return
 	}
-	db, err := database.NewDB("database.json")
+	user, err := cfg.db.GetUserByEmail(params.Email)
+	if errors.Is(err, database.ErrNotFound) {
+		respondWithError(w, 401, "Wrong email!")
+		return
+	}
 	if err != nil {
-		respondWithError(w, 500, "Something went wrong with the DB!")
-		return
-	}
-	dbStructure, err := db.LoadDB()
-	for _, user := range dbStructure.Users {
-		if strings.ToLower(user.Email) == strings.ToLower(params.Email) {
-			err = bcrypt.CompareHashAndPassword([]byte(user.Password), []byte(params.Password))
-			if err != nil {
-				log.Print(err)
-				respondWithError(w, 401, "Wrong password!")
-				return
-			}
-			// Create JWT Tokens
-			now := time.Now()
-			jwtClaimsAccess := jwt.RegisteredClaims{
-				Issuer:    "Chirpy-Access",
-				IssuedAt:  jwt.NewNumericDate(now),
-				ExpiresAt: jwt.NewNumericDate(now.Add(time.Hour)),
-				Subject:   fmt.Sprintf("%d", user.Id),
-			}
-			jwtAccessToken := jwt.NewWithClaims(jwt.SigningMethodHS256, jwtClaimsAccess)
-			// https://github.com/dgrijalva/jwt-go/issues/65#issuecomment-98019456
-			jwtStringAccess, err := jwtAccessToken.SignedString([]byte(cfg.jwtSecret))
-			if err != nil {
-				log.Print(err.Error())
-				respondWithError(w, 500, "Something went wrong!")
-				return
-			}
+		respondWithDBError(w, err)
+		return
+	}
+	err = bcrypt.CompareHashAndPassword([]byte(user.Password), []byte(params.Password))
+	if err != nil {
+		log.Print(err)
+		respondWithError(w, 401, "Wrong password!")
+		return
+	}
+	// Create JWT Tokens
+	now := time.Now()
+	jwtClaimsAccess := jwt.RegisteredClaims{
+		Issuer:    "Chirpy-Access",
+		IssuedAt:  jwt.NewNumericDate(now),
+		ExpiresAt: jwt.NewNumericDate(now.Add(time.Hour)),
+		Subject:   fmt.Sprintf("%d", user.Id),
+	}
+	jwtAccessToken := jwt.NewWithClaims(jwt.SigningMethodHS256, jwtClaimsAccess)
+	// https://github.com/dgrijalva/jwt-go/issues/65#issuecomment-98019456
+	jwtStringAccess, err := jwtAccessToken.SignedString([]byte(cfg.jwtSecret))
+	if err != nil {
+		log.Print(err.Error())
+		respondWithError(w, 500, "Something went wrong!")
+		return
+	}
 
-			jwtClaimsRefresh := jwt.RegisteredClaims{
-				Issuer:    "Chirpy-Refresh",
-				IssuedAt:  jwt.NewNumericDate(now),
-				ExpiresAt: jwt.NewNumericDate(now.Add(time.Hour * 1440)),
-				Subject:   fmt.Sprintf("%d", user.Id),
-			}
-			jwtRefreshToken := jwt.NewWithClaims(jwt.SigningMethodHS256, jwtClaimsRefresh)
-			// https://github.com/dgrijalva/jwt-go/issues/65#issuecomment-98019456
-			jwtStringRefresh, err := jwtRefreshToken.SignedString([]byte(cfg.jwtSecret))
-			if err != nil {
-				log.Print(err.Error())
-				respondWithError(w, 500, "Something went wrong!")
-				return
-			}
-			response := struct {
-				Id           int    `json:"id"`
-				Email        string `json:"email"`
-				IsChirpyRed  bool   `json:"is_chirpy_red"`
-				Token        string `json:"token"`
-				RefreshToken string `json:"refresh_token"`
-			}{
-				Id:           user.Id,
-				Email:        user.Email,
-				IsChirpyRed:  user.IsChirpyRed,
-				Token:        jwtStringAccess,
-				RefreshToken: jwtStringRefresh,
-			}
-			respondWithJSON(w, 200, response)
-			return
-		}
-	}
-	respondWithError(w, 401, "Wrong email!")
+	jwtClaimsRefresh := jwt.RegisteredClaims{
+		Issuer:    "Chirpy-Refresh",
+		IssuedAt:  jwt.NewNumericDate(now),
+		ExpiresAt: jwt.NewNumericDate(now.Add(time.Hour * 1440)),
+		Subject:   fmt.Sprintf("%d", user.Id),
+	}
+	jwtRefreshToken := jwt.NewWithClaims(jwt.SigningMethodHS256, jwtClaimsRefresh)
+	// https://github.com/dgrijalva/jwt-go/issues/65#issuecomment-98019456
+	jwtStringRefresh, err := jwtRefreshToken.SignedString([]byte(cfg.jwtSecret))
+	if err != nil {
+		log.Print(err.Error())
+		respondWithError(w, 500, "Something went wrong!")
+		return
+	}
+	response := struct {
+		Id           int    `json:"id"`
+		Uid          string `json:"uid,omitempty"`
+		Email        string `json:"email"`
+		IsChirpyRed  bool   `json:"is_chirpy_red"`
+		Token        string `json:"token"`
+		RefreshToken string `json:"refresh_token"`
+	}{
+		Id:           user.Id,
+		Uid:          user.Uid,
+		Email:        user.Email,
+		IsChirpyRed:  user.IsChirpyRed,
+		Token:        jwtStringAccess,
+		RefreshToken: jwtStringRefresh,
+	}
+	respondWithJSON(w, 200, response)
 	return
 }
 
@@ -144,29 +143,22 @@ func (cfg *apiConfig) handlerPutUsers(w http.ResponseWriter, r *http.Request) {
 		respondWithError(w, 500, "Something went wrong!")
 		return
 	}
-	db, err := database.NewDB("database.json")
-	if err != nil {
-		log.Print(err.Error())
-		respondWithError(w, 500, "Something went wrong!")
-		return
-	}
 	userIdInt, err := strconv.Atoi(userId)
 	if err != nil {
 		log.Print(err.Error())
 		respondWithError(w, 500, "Something went wrong!")
 		return
 	}
-	user, err := db.UpdateUser(userIdInt, params.Email, params.Password)
+	user, err := cfg.db.UpdateUser(userIdInt, params.Email, params.Password)
 	if err != nil {
-		log.Print(err.Error())
-		respondWithError(w, 500, "Something went wrong!")
+		respondWithDBError(w, err)
 		return
 	}
 	respondWithJSON(w, 200, user)
 	return
 }
 
-func handlerPostUser(w http.ResponseWriter, r *http.Request) {
+func (cfg *apiConfig) handlerPostUser(w http.ResponseWriter, r *http.Request) {
 	type parameters struct {
 		Email    string `json:"email"`
 		Password string `json:"password"`
@@ -182,27 +174,23 @@ func handlerPostUser(w http.ResponseWriter, r *http.Request) {
 		respondWithError(w, 422, "Invalid email!")
 		return
 	}
-	db, err := database.NewDB("database.json")
-	if err != nil {
-		respondWithError(w, 500, "Something went wrong with the DB!")
-		return
-	}
 	hashedPassword, err := bcrypt.GenerateFromPassword([]byte(params.Password), 10)
 	if err != nil {
 		respondWithError(w, 500, "Something went wrong!")
 		return
 	}
-	user, err := db.CreateUser(params.Email, fmt.Sprintf("%s", hashedPassword))
+	user, err := cfg.db.CreateUser(params.Email, fmt.Sprintf("%s", hashedPassword))
 	if err != nil {
-		// Is this okay?
-		respondWithError(w, 500, err.Error())
+		respondWithDBError(w, err)
 		return
 	}
 	response := struct {
 		Id    int    `json:"id"`
+		Uid   string `json:"uid,omitempty"`
 		Email string `json:"email"`
 	}{
 		Id:    user.Id,
+		Uid:   user.Uid,
 		Email: user.Email,
 	}
 	respondWithJSON(w, 201, response)
@@ -6,7 +6,6 @@ import (
 	"log"
 	"net/http"
 	"os"
-	"strings"
 )
 
 func deleteDatabase(path string) error {
@@ -60,23 +59,3 @@ func respondWithJSON(w http.ResponseWriter, code int, payload interface{}) {
 	w.Write(dat)
 	return
 }
-
-func cleanTheProfanities(msg string, profaneWords []string) string {
-	splitMsg := strings.Split(msg, " ")
-	var msgCensoredSlice []string = make([]string, len(splitMsg))
-	var found bool
-	for index, word := range splitMsg {
-		found = false
-		for _, profaneWord := range profaneWords {
-			if strings.ToLower(word) == profaneWord {
-				msgCensoredSlice[index] = "****"
-				found = true
-				break
-			}
-		}
-		if found == false {
-			msgCensoredSlice[index] = word
-		}
-	}
-	return strings.Join(msgCensoredSlice, " ")
-}
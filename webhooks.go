@@ -5,8 +5,6 @@ import (
 	"log"
 	"net/http"
 	"strings"
-
-	"github.com/aliasboink/go_web_server/internal/database"
 )
 
 func (cfg *apiConfig) handlerPostPolkaWebhook(w http.ResponseWriter, r *http.Request) {
@@ -33,16 +31,9 @@ func (cfg *apiConfig) handlerPostPolkaWebhook(w http.ResponseWriter, r *http.Req
 		w.WriteHeader(200)
 		return
 	}
-	db, err := database.NewDB("database.json")
-	if err != nil {
-		log.Print(err.Error())
-		respondWithError(w, 500, "Something went wrong!")
-		return
-	}
-	_, err = db.UpgradeUser(params.Data.UserId)
+	_, err = cfg.db.UpgradeUser(params.Data.UserId)
 	if err != nil {
-		log.Print(err.Error())
-		respondWithError(w, 500, "Something went wrong!")
+		respondWithDBError(w, err)
 		return
 	}
 	w.WriteHeader(200)